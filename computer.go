@@ -0,0 +1,51 @@
+package gojenkins
+
+type Computers struct {
+	BusyExecutors  int        `json:"busyExecutors"`
+	TotalExecutors int        `json:"totalExecutors"`
+	Computers      []Computer `json:"computer"`
+}
+
+type Computer struct {
+	Class       string `json:"_class"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description"`
+
+	Idle               bool   `json:"idle"`
+	Offline            bool   `json:"offline"`
+	TemporarilyOffline bool   `json:"temporarilyOffline"`
+	OfflineCauseReason string `json:"offlineCauseReason"`
+	NumExecutors       int    `json:"numExecutors"`
+
+	AssignedLabels []ComputerLabel `json:"assignedLabels"`
+
+	MonitorData map[string]interface{} `json:"monitorData"`
+}
+
+type ComputerLabel struct {
+	Name string `json:"name"`
+}
+
+// Label is a node label, or a label expression such as "linux && docker", and the nodes matching it.
+type Label struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	BusyExecutors  int    `json:"busyExecutors"`
+	IdleExecutors  int    `json:"idleExecutors"`
+	TotalExecutors int    `json:"totalExecutors"`
+	Offline        bool   `json:"offline"`
+
+	Nodes []LabelNode `json:"nodes"`
+}
+
+type LabelNode struct {
+	Class    string `json:"_class"`
+	NodeName string `json:"nodeName"`
+}
+
+// ExecutorStats is a summary of how busy Jenkins is.
+type ExecutorStats struct {
+	TotalExecutors int
+	BusyExecutors  int
+	QueueLength    int
+}
@@ -0,0 +1,43 @@
+package gojenkins
+
+// Fingerprint tracks where a file, identified by its MD5 checksum, was produced and used.
+type Fingerprint struct {
+	FileName string             `json:"fileName"`
+	Hash     string             `json:"hash"`
+	Original *FingerprintBuild  `json:"original"`
+	Usage    []FingerprintUsage `json:"usage"`
+	// Timestamp is when the fingerprint was first recorded, in milliseconds since the epoch.
+	Timestamp int64 `json:"timestamp"`
+}
+
+// FingerprintBuild is the build which produced a file. Name is the full name of its job.
+// It is nil when the file came from outside of Jenkins.
+type FingerprintBuild struct {
+	Name   string `json:"name"`
+	Number int    `json:"number"`
+}
+
+// FingerprintUsage lists the builds of the job which has the full name Name that used a file.
+type FingerprintUsage struct {
+	Name   string `json:"name"`
+	Ranges struct {
+		Ranges []FingerprintRange `json:"ranges"`
+	} `json:"ranges"`
+}
+
+// FingerprintRange is a range of build numbers, from Start up to but not including End.
+type FingerprintRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Numbers returns the numbers of the builds that used the file.
+func (usage FingerprintUsage) Numbers() []int {
+	var numbers []int
+	for _, r := range usage.Ranges.Ranges {
+		for number := r.Start; number < r.End; number++ {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
@@ -2,37 +2,209 @@ package gojenkins
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	// ErrTimeout is returned when waiting on Jenkins takes longer than the given timeout.
+	ErrTimeout = errors.New("jenkins: timed out")
+
+	// ErrQueueItemCancelled is returned when waiting on a queue item which has been cancelled.
+	ErrQueueItemCancelled = errors.New("jenkins: queue item was cancelled")
+
+	// ErrQueueItemPending is returned by GetBuildNumberFromQueueItem while the item is still waiting to be built.
+	ErrQueueItemPending = errors.New("jenkins: queue item has not started building yet")
+
+	// ErrNoBuilds is returned when a job has no build matching the request, e.g. it has never built.
+	ErrNoBuilds = errors.New("jenkins: job has no such build")
+
+	// ErrJobDisabled is returned when triggering a build of a disabled job.
+	ErrJobDisabled = errors.New("jenkins: job is disabled")
+
+	// ErrPermissionDenied matches, with errors.Is, any *HTTPError for a 403 response.
+	ErrPermissionDenied = errors.New("jenkins: permission denied")
+
+	// ErrNoTestResults is returned for builds which did not publish test results.
+	ErrNoTestResults = errors.New("jenkins: build has no test results")
+
+	// ErrNoEnvVars is returned for builds without injected environment variables,
+	// e.g. when the EnvInject plugin is not installed.
+	ErrNoEnvVars = errors.New("jenkins: build has no injected environment variables")
+
+	// ErrCrumbIssuerDisabled is returned by GetCrumb when CSRF protection is disabled.
+	ErrCrumbIssuerDisabled = errors.New("jenkins: crumb issuer is disabled")
+
+	// ErrLoginFailed is returned by Login when Jenkins rejects the username or password.
+	ErrLoginFailed = errors.New("jenkins: invalid username or password")
+
+	// ErrNotPipeline is returned for builds which have no pipeline stages, e.g. freestyle builds.
+	ErrNotPipeline = errors.New("jenkins: build is not a pipeline build")
+)
+
+// Auth holds the credentials requests are sent with.
+// BearerToken, when set, is sent as an "Authorization: Bearer" header instead of basic auth.
 type Auth struct {
-	Username string
-	ApiToken string
+	Username    string
+	ApiToken    string
+	BearerToken string
 }
 
 type Jenkins struct {
 	auth    *Auth
 	baseUrl string
+	client  *http.Client
+
+	// MaxRetries is how many times a GET request is retried after a connection error or a
+	// 502, 503 or 504 response. Other requests are never retried, so that builds are not triggered twice.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles with every further retry.
+	RetryBackoff time.Duration
+
+	// RequestHook, when set, is called after every request is sent, e.g. to log it.
+	// The Authorization header of req is redacted.
+	RequestHook func(req *http.Request, resp *http.Response, err error)
+
+	// UserAgent is sent as the User-Agent header of every request.
+	UserAgent string
+	// ConsolePollInterval is how long StreamConsole waits before asking for more output.
+	ConsolePollInterval time.Duration
+	// DefaultHeaders are added to every request, e.g. for an authenticating proxy.
+	// They do not replace the headers a request sets itself, such as its Content-Type.
+	DefaultHeaders http.Header
+
+	// crumbMutex guards crumb and crumbFetched, and is held while the crumb is fetched so that
+	// concurrent requests wait for a single fetch.
+	crumbMutex   sync.Mutex
+	crumb        *crumb
+	crumbFetched bool
 }
 
+// DefaultUserAgent is the UserAgent of a Jenkins created by NewJenkins or NewJenkinsWithClient.
+const DefaultUserAgent = "golang-jenkins/1.0"
+
+type crumb struct {
+	RequestField string `json:"crumbRequestField"`
+	Value        string `json:"crumb"`
+}
+
+// NewJenkins returns a Jenkins for the instance at baseUrl.
+// auth may be nil to access Jenkins anonymously.
 func NewJenkins(auth *Auth, baseUrl string) *Jenkins {
+	return NewJenkinsWithClient(auth, baseUrl, nil)
+}
+
+// NewJenkinsWithClient returns a Jenkins which sends its requests through client.
+// http.DefaultClient is used when client is nil.
+func NewJenkinsWithClient(auth *Auth, baseUrl string, client *http.Client) *Jenkins {
+	if client == nil {
+		client = http.DefaultClient
+	}
 	return &Jenkins{
-		auth:    auth,
-		baseUrl: baseUrl,
+		auth:      auth,
+		baseUrl:   strings.TrimRight(baseUrl, "/"),
+		client:    client,
+		UserAgent: DefaultUserAgent,
+
+		ConsolePollInterval: time.Second,
 	}
 }
 
+// HTTPError is returned when Jenkins answers a request with a non-2xx status code.
+type HTTPError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("jenkins: %s %s returned %d: %s", err.Method, err.Url, err.StatusCode, err.Body)
+}
+
+// Is lets errors.Is match 403 responses against ErrPermissionDenied.
+func (err *HTTPError) Is(target error) bool {
+	return target == ErrPermissionDenied && err.StatusCode == http.StatusForbidden
+}
+
+func isStatus(err error, statusCode int) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == statusCode
+}
+
 func (jenkins *Jenkins) buildUrl(path string, params url.Values) (requestUrl string) {
-	requestUrl = jenkins.baseUrl + path + "/api/json"
+	return jenkins.buildRawUrl(path+"/api/json", params)
+}
+
+// jobPath returns the url path of a job from its name, which may be a slash-separated folder path
+// such as "team/deploy". Each name is escaped, so that e.g. the branch job multibranch projects
+// name "feature%2Ffoo" for branch feature/foo is found at ".../job/feature%252Ffoo".
+func jobPath(name string) (path string) {
+	for _, segment := range strings.Split(strings.Trim(name, "/"), "/") {
+		path += "/job/" + url.PathEscape(segment)
+	}
+	return
+}
+
+// viewPath returns the url path of the view which has specified name.
+func viewPath(name string) string {
+	return "/view/" + url.PathEscape(name)
+}
+
+// computerPaths returns the url paths the named computer may be at.
+// The built-in node is at "/computer/(built-in)" since Jenkins 2.307 and at "/computer/(master)" before.
+func computerPaths(name string) []string {
+	switch name {
+	case "master", "(master)", "built-in", "(built-in)", "Built-In Node":
+		return []string{"/computer/(built-in)", "/computer/(master)"}
+	}
+	return []string{"/computer/" + url.PathEscape(name)}
+}
+
+// withComputerPath calls fn with each url path the named computer may be at until one is not a 404.
+func withComputerPath(name string, fn func(path string) error) (err error) {
+	for _, path := range computerPaths(name) {
+		if err = fn(path); !isStatus(err, http.StatusNotFound) {
+			return
+		}
+	}
+	return
+}
+
+// objectApiUrl returns the JSON API url of an object, such as a build, known by its absolute url.
+func objectApiUrl(objectUrl string, params url.Values) (requestUrl string) {
+	requestUrl = strings.TrimSuffix(objectUrl, "/") + "/api/json"
+	if params != nil {
+		queryString := params.Encode()
+		if queryString != "" {
+			requestUrl = requestUrl + "?" + queryString
+		}
+	}
+
+	return
+}
+
+// buildRawUrl is like buildUrl but does not point the request at the JSON API.
+func (jenkins *Jenkins) buildRawUrl(path string, params url.Values) (requestUrl string) {
+	requestUrl = jenkins.baseUrl + path
 	if params != nil {
 		queryString := params.Encode()
 		if queryString != "" {
@@ -44,8 +216,217 @@ func (jenkins *Jenkins) buildUrl(path string, params url.Values) (requestUrl str
 }
 
 func (jenkins *Jenkins) sendRequest(req *http.Request) (*http.Response, error) {
-	req.SetBasicAuth(jenkins.auth.Username, jenkins.auth.ApiToken)
-	return http.DefaultClient.Do(req)
+	for key, values := range jenkins.DefaultHeaders {
+		if _, ok := req.Header[http.CanonicalHeaderKey(key)]; !ok {
+			req.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	if jenkins.UserAgent != "" {
+		req.Header.Set("User-Agent", jenkins.UserAgent)
+	}
+	// Asking for gzip explicitly stops the transport from decompressing, so decodeResponse does it.
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	switch {
+	case jenkins.auth == nil:
+	case jenkins.auth.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+jenkins.auth.BearerToken)
+	case jenkins.auth.Username != "" || jenkins.auth.ApiToken != "":
+		req.SetBasicAuth(jenkins.auth.Username, jenkins.auth.ApiToken)
+	}
+	var sentCrumb *crumb
+	if req.Method == "POST" && req.Context().Value(withoutCrumbKey{}) == nil {
+		var err error
+		if sentCrumb, err = jenkins.getCrumb(req.Context()); err != nil {
+			return nil, err
+		}
+		if sentCrumb != nil {
+			req.Header.Set(sentCrumb.RequestField, sentCrumb.Value)
+		}
+	}
+
+	resp, err := jenkins.do(req)
+	// A crumb stops being valid when its session expires or Jenkins restarts, which Jenkins answers
+	// with 403. The request is then sent once more with a new crumb, if its body can be sent again.
+	if sentCrumb != nil && err == nil && resp.StatusCode == http.StatusForbidden && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		resp.Body.Close()
+		if req, err = jenkins.withNewCrumb(req, sentCrumb); err != nil {
+			return nil, err
+		}
+		resp, err = jenkins.do(req)
+	}
+	for retry := 0; retry < jenkins.MaxRetries && shouldRetry(req, resp, err); retry++ {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(jenkins.RetryBackoff << uint(retry)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		resp, err = jenkins.do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(resp)
+}
+
+// decodeResponse replaces the body of a gzip encoded resp with its decompressed content.
+// Responses to HEAD requests have no body to decompress.
+func decodeResponse(resp *http.Response) (*http.Response, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || resp.Request.Method == "HEAD" {
+		return resp, nil
+	}
+
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &gzipBody{reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody is a decompressed response body which closes the underlying body too.
+type gzipBody struct {
+	reader *gzip.Reader
+	body   io.ReadCloser
+}
+
+func (body *gzipBody) Read(p []byte) (int, error) {
+	return body.reader.Read(p)
+}
+
+func (body *gzipBody) Close() error {
+	body.reader.Close()
+	return body.body.Close()
+}
+
+// do sends req through the client, reporting it to the RequestHook.
+func (jenkins *Jenkins) do(req *http.Request) (*http.Response, error) {
+	resp, err := jenkins.client.Do(req)
+	if jenkins.RequestHook != nil {
+		hookReq := req
+		if req.Header.Get("Authorization") != "" {
+			hookReq = req.Clone(req.Context())
+			hookReq.Header.Set("Authorization", "REDACTED")
+		}
+		jenkins.RequestHook(hookReq, resp, err)
+	}
+	return resp, err
+}
+
+// shouldRetry reports whether req, which got resp and err, failed transiently and is safe to send again.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != "GET" || req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// getCrumb returns the CSRF crumb to send with POST requests, fetching it on first use.
+// It returns nil when the crumb issuer is disabled.
+func (jenkins *Jenkins) getCrumb(ctx context.Context) (*crumb, error) {
+	jenkins.crumbMutex.Lock()
+	defer jenkins.crumbMutex.Unlock()
+
+	if jenkins.crumbFetched {
+		return jenkins.crumb, nil
+	}
+
+	issued, err := jenkins.fetchCrumb(ctx)
+	if err != nil && err != ErrCrumbIssuerDisabled {
+		return nil, err
+	}
+	jenkins.crumb = issued
+	jenkins.crumbFetched = true
+	return jenkins.crumb, nil
+}
+
+// withoutCrumbKey marks the context of a POST request which must be sent without a crumb.
+type withoutCrumbKey struct{}
+
+// withNewCrumb forgets the rejected crumb, unless another request replaced it already,
+// and returns a copy of req carrying the current crumb.
+func (jenkins *Jenkins) withNewCrumb(req *http.Request, rejected *crumb) (*http.Request, error) {
+	jenkins.crumbMutex.Lock()
+	if jenkins.crumb == rejected {
+		jenkins.crumb = nil
+		jenkins.crumbFetched = false
+	}
+	jenkins.crumbMutex.Unlock()
+
+	current, err := jenkins.getCrumb(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Del(rejected.RequestField)
+	if current != nil {
+		retry.Header.Set(current.RequestField, current.Value)
+	}
+	return retry, nil
+}
+
+// fetchCrumb asks the crumb issuer for a crumb. It returns ErrCrumbIssuerDisabled when there is none.
+func (jenkins *Jenkins) fetchCrumb(ctx context.Context) (*crumb, error) {
+	var issued crumb
+	err := jenkins.get(ctx, "/crumbIssuer", nil, &issued)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, ErrCrumbIssuerDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// GetCrumb returns the CSRF crumb to send, as the value of the header named field, with requests
+// made outside of this package. It returns ErrCrumbIssuerDisabled when Jenkins does not require one.
+func (jenkins *Jenkins) GetCrumb() (field string, value string, err error) {
+	issued, err := jenkins.fetchCrumb(context.Background())
+	if err != nil {
+		return "", "", err
+	}
+	return issued.RequestField, issued.Value, nil
+}
+
+// checkResponse returns an *HTTPError, closing the body, unless resp has a 2xx status code.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	return &HTTPError{
+		Method:     resp.Request.Method,
+		Url:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       data,
+	}
 }
 
 func (jenkins *Jenkins) parseXmlResponse(resp *http.Response, body interface{}) (err error) {
@@ -60,25 +441,25 @@ func (jenkins *Jenkins) parseXmlResponse(resp *http.Response, body interface{})
 		return
 	}
 
-	return xml.Unmarshal(data, body)
+	return unmarshalXml(data, body)
+}
+
+// xmlDeclaration11 matches the XML 1.1 declaration Jenkins writes in config.xml files.
+var xmlDeclaration11 = regexp.MustCompile(`^\s*<\?xml\s+version=["']1\.1["']`)
+
+// unmarshalXml is like xml.Unmarshal but also accepts XML 1.1 documents, which encoding/xml refuses
+// although Jenkins configurations do not use anything specific to 1.1.
+func unmarshalXml(data []byte, v interface{}) error {
+	if loc := xmlDeclaration11.FindIndex(data); loc != nil {
+		data = append([]byte(`<?xml version="1.0"`), data[loc[1]:]...)
+	}
+	return xml.Unmarshal(data, v)
 }
 
 func (jenkins *Jenkins) parseResponse(resp *http.Response, body interface{}) (err error) {
 	defer resp.Body.Close()
 
 	if body == nil {
-		// If the response contains only a location header pointing to a queue item, return that
-		// queue item.
-		switch body.(type) {
-		case *Item:
-			loc := resp.Header.Get("Location")
-			if loc != "" {
-				// FIXME: this will break if jenkins isn't at the root of the webserver url
-				itemNo, _ := strconv.Atoi(strings.Split(loc, "/")[5])
-				body, err = jenkins.GetQueueItem(itemNo)
-				return
-			}
-		}
 		return
 	}
 
@@ -90,178 +471,1764 @@ func (jenkins *Jenkins) parseResponse(resp *http.Response, body interface{}) (er
 	return json.Unmarshal(data, body)
 }
 
-func (jenkins *Jenkins) get(path string, params url.Values, body interface{}) (err error) {
-	requestUrl := jenkins.buildUrl(path, params)
-	req, err := http.NewRequest("GET", requestUrl, nil)
-	if err != nil {
+// parseQueueItemResponse fills item with the queue item the Location header of resp points at,
+// as Jenkins answers a build trigger with e.g. "Location: http://jenkins/queue/item/42/".
+func (jenkins *Jenkins) parseQueueItemResponse(ctx context.Context, resp *http.Response, item *Item) (err error) {
+	resp.Body.Close()
+
+	loc := resp.Header.Get("Location")
+	if loc == "" {
 		return
 	}
 
-	resp, err := jenkins.sendRequest(req)
+	itemNo, err := queueItemNumber(loc)
 	if err != nil {
 		return
 	}
-	return jenkins.parseResponse(resp, body)
+	return jenkins.get(ctx, fmt.Sprintf("/queue/item/%d", itemNo), nil, item)
 }
 
-func (jenkins *Jenkins) getXml(path string, params url.Values, body interface{}) (err error) {
-	requestUrl := jenkins.buildUrl(path, params)
-	req, err := http.NewRequest("GET", requestUrl, nil)
+var queueItemPathPattern = regexp.MustCompile(`/queue/item/(\d+)/?$`)
+
+// queueItemNumber returns the number of the queue item location points at, wherever Jenkins is
+// mounted on the webserver.
+func queueItemNumber(location string) (int, error) {
+	locationUrl, err := url.Parse(location)
 	if err != nil {
-		return
+		return 0, err
+	}
+
+	match := queueItemPathPattern.FindStringSubmatch(locationUrl.Path)
+	if match == nil {
+		return 0, fmt.Errorf("jenkins: %s is not a queue item location", location)
+	}
+	return strconv.Atoi(match[1])
+}
+
+// request sends a request with the given content type and body to requestUrl and returns the
+// checked response. The caller must close the response body.
+func (jenkins *Jenkins) request(ctx context.Context, method, requestUrl, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
 	}
 
 	resp, err := jenkins.sendRequest(req)
 	if err != nil {
-		return
+		return nil, err
 	}
-	return jenkins.parseXmlResponse(resp, body)
+	if err = checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
-func (jenkins *Jenkins) post(path string, params url.Values, body interface{}) (err error) {
-	requestUrl := jenkins.buildUrl(path, params)
-	req, err := http.NewRequest("POST", requestUrl, nil)
+func (jenkins *Jenkins) get(ctx context.Context, path string, params url.Values, body interface{}) (err error) {
+	return jenkins.getUrl(ctx, jenkins.buildUrl(path, params), body)
+}
+
+func (jenkins *Jenkins) getUrl(ctx context.Context, requestUrl string, body interface{}) (err error) {
+	resp, err := jenkins.getRaw(ctx, requestUrl)
 	if err != nil {
 		return
 	}
+	return jenkins.parseResponse(resp, body)
+}
 
-	resp, err := jenkins.sendRequest(req)
+// getRaw sends a GET request to requestUrl and returns the checked response.
+// The caller must close the response body.
+func (jenkins *Jenkins) getRaw(ctx context.Context, requestUrl string) (*http.Response, error) {
+	return jenkins.request(ctx, "GET", requestUrl, "", nil)
+}
+
+func (jenkins *Jenkins) post(ctx context.Context, path string, params url.Values, body interface{}) (err error) {
+	resp, err := jenkins.request(ctx, "POST", jenkins.buildRawUrl(path, params), "", nil)
 	if err != nil {
 		return
 	}
 
+	if item, ok := body.(*Item); ok {
+		return jenkins.parseQueueItemResponse(ctx, resp, item)
+	}
 	return jenkins.parseResponse(resp, body)
 }
-func (jenkins *Jenkins) postXml(path string, params url.Values, xmlBody io.Reader, body interface{}) (err error) {
-	requestUrl := jenkins.baseUrl + path
-	if params != nil {
-		queryString := params.Encode()
-		if queryString != "" {
-			requestUrl = requestUrl + "?" + queryString
-		}
-	}
 
-	req, err := http.NewRequest("POST", requestUrl, xmlBody)
+// postForm posts form url-encoded in the request body, rather than in the query string like post.
+func (jenkins *Jenkins) postForm(ctx context.Context, path string, form url.Values, body interface{}) (err error) {
+	resp, err := jenkins.request(ctx, "POST", jenkins.buildRawUrl(path, nil), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
 	if err != nil {
 		return
 	}
 
-	req.Header.Add("Content-Type", "application/xml")
-	resp, err := jenkins.sendRequest(req)
+	if item, ok := body.(*Item); ok {
+		return jenkins.parseQueueItemResponse(ctx, resp, item)
+	}
+	return jenkins.parseResponse(resp, body)
+}
+
+func (jenkins *Jenkins) postXml(ctx context.Context, path string, params url.Values, xmlBody io.Reader, body interface{}) (err error) {
+	resp, err := jenkins.request(ctx, "POST", jenkins.buildRawUrl(path, params), "application/xml", xmlBody)
 	if err != nil {
 		return
 	}
-	if resp.StatusCode != 200 {
-		return errors.New(fmt.Sprintf("error: HTTP POST returned status code returned: %d", resp.StatusCode))
-	}
-
 	return jenkins.parseXmlResponse(resp, body)
 }
 
-// GetJobs returns all jobs you can read.
-func (jenkins *Jenkins) GetJobs() ([]Job, error) {
-	var payload = struct {
-		Jobs []Job `json:"jobs"`
-	}{}
-	err := jenkins.get("", nil, &payload)
-	return payload.Jobs, err
-}
-
-// GetJob returns a job which has specified name.
-func (jenkins *Jenkins) GetJob(name string) (job Job, err error) {
-	err = jenkins.get(fmt.Sprintf("/job/%s", name), nil, &job)
-	return
+// Do sends a request to any path, relative to the Jenkins root, with the same authentication,
+// crumb and status code handling as the other methods, and unmarshals the JSON response into
+// respBody unless it is nil. Unlike the other methods, path is not suffixed with "/api/json".
+// A failed request returns an *HTTPError.
+func (jenkins *Jenkins) Do(method, path string, params url.Values, reqBody io.Reader, respBody interface{}) error {
+	resp, err := jenkins.request(context.Background(), method, jenkins.buildRawUrl(path, params), "", reqBody)
+	if err != nil {
+		return err
+	}
+	return jenkins.parseResponse(resp, respBody)
 }
 
-//GetJobConfig returns a maven job, has the one used to create Maven job
-func (jenkins *Jenkins) GetJobConfig(name string) (job MavenJobItem, err error) {
-	err = jenkins.getXml(fmt.Sprintf("/job/%s/config.xml", name), nil, &job)
-	return
+// GetWithTree unmarshals the JSON API of path, relative to the Jenkins root, into body.
+// Only the fields selected by tree, e.g. "jobs[name,color]", are returned by Jenkins, which keeps
+// responses small on large instances.
+func (jenkins *Jenkins) GetWithTree(path, tree string, body interface{}) error {
+	params := url.Values{"tree": []string{tree}}
+	return jenkins.get(context.Background(), path, params, body)
 }
 
-// GetBuild returns a number-th build result of specified job.
-func (jenkins *Jenkins) GetBuild(job Job, number int) (build Build, err error) {
-	err = jenkins.get(fmt.Sprintf("/job/%s/%d", job.Name, number), nil, &build)
-	return
+// ServerInfo describes the running Jenkins instance.
+type ServerInfo struct {
+	// Version is the Jenkins version, e.g. "2.401.1".
+	Version string
+	// Session identifies the current run of Jenkins; it changes when Jenkins restarts.
+	Session string
 }
 
-// Create a new job
-func (jenkins *Jenkins) CreateJob(mavenJobItem MavenJobItem, jobName string) error {
-	mavenJobItemXml, _ := xml.Marshal(mavenJobItem)
-	reader := bytes.NewReader(mavenJobItemXml)
-	params := url.Values{"name": []string{jobName}}
-
-	return jenkins.postXml("/createItem", params, reader, nil)
-}
+// GetServerInfo returns the version and session of Jenkins, read from the headers of an API response.
+func (jenkins *Jenkins) GetServerInfo() (info ServerInfo, err error) {
+	params := url.Values{"tree": []string{"nodeName"}}
+	res, err := jenkins.getRaw(context.Background(), jenkins.buildUrl("", params))
+	if err != nil {
+		return
+	}
 
-// Add job to view
-func (jenkins *Jenkins) AddJobToView(viewName string, job Job) error {
-	params := url.Values{"name": []string{job.Name}}
-	return jenkins.post(fmt.Sprintf("/view/%s/addJobToView", viewName), params, nil)
+	res.Body.Close()
+	info.Version = res.Header.Get("X-Jenkins")
+	info.Session = res.Header.Get("X-Jenkins-Session")
+	return
 }
 
-// Create a new view
-func (jenkins *Jenkins) CreateView(listView ListView) error {
-	xmlListView, _ := xml.Marshal(listView)
-	reader := bytes.NewReader(xmlListView)
-	params := url.Values{"name": []string{listView.Name}}
-
-	return jenkins.postXml("/createView", params, reader, nil)
+// GetVersion returns the Jenkins version, e.g. "2.401.1".
+func (jenkins *Jenkins) GetVersion() (string, error) {
+	info, err := jenkins.GetServerInfo()
+	return info.Version, err
 }
 
-// Create a new build for this job.
-// Params can be nil.
-func (jenkins *Jenkins) Build(job Job, params url.Values) (item Item, err error) {
-	if params == nil {
-		err = jenkins.post(fmt.Sprintf("/job/%s/build", job.Name), params, &item)
-	} else {
-		err = jenkins.post(fmt.Sprintf("/job/%s/buildWithParameters", job.Name), params, &item)
+// Login signs in with the login form of Jenkins' own user database, for instances which do not
+// accept API tokens. Later requests are authenticated with the session cookie it gets, which is
+// kept in the cookie jar of the client; a client without one is copied and given a jar.
+func (jenkins *Jenkins) Login(username, password string) error {
+	if jenkins.client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+		client := *jenkins.client
+		client.Jar = jar
+		jenkins.client = &client
 	}
-	return
-}
 
-// Get the console output from a build.
-func (jenkins *Jenkins) GetBuildConsoleOutput(build Build) ([]byte, error) {
-	requestUrl := fmt.Sprintf("%s/consoleText", build.Url)
-	req, err := http.NewRequest("GET", requestUrl, nil)
+	form := url.Values{
+		"j_username": []string{username},
+		"j_password": []string{password},
+		"from":       []string{"/"},
+	}
+	// Crumbs are bound to the session, which only starts with the login, and instances requiring a
+	// login usually refuse to issue one to anonymous users, so the login is sent without a crumb.
+	ctx := context.WithValue(context.Background(), withoutCrumbKey{}, true)
+	resp, err := jenkins.request(ctx, "POST", jenkins.buildRawUrl("/j_spring_security_check", nil), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
 	if err != nil {
-		return nil, err
+		return err
 	}
+	resp.Body.Close()
 
-	res, err := jenkins.sendRequest(req)
-	if err != nil {
-		return nil, err
+	// Jenkins redirects failed attempts to the loginError page rather than answering with an error status.
+	if strings.Contains(resp.Request.URL.Path, "loginError") {
+		return ErrLoginFailed
 	}
 
-	defer res.Body.Close()
-	return ioutil.ReadAll(res.Body)
+	// A crumb is only valid for the session it was issued to.
+	jenkins.crumbMutex.Lock()
+	jenkins.crumb = nil
+	jenkins.crumbFetched = false
+	jenkins.crumbMutex.Unlock()
+	return nil
 }
 
-// GetQueue returns the current build queue from Jenkins
-func (jenkins *Jenkins) GetQueue() (queue Queue, err error) {
-	err = jenkins.get(fmt.Sprintf("/queue"), nil, &queue)
-	return
-}
+// WhoAmI returns the user requests are authenticated as, which is a cheap way to check credentials.
+func (jenkins *Jenkins) WhoAmI() (user User, err error) {
+	var whoAmI = struct {
+		User
+		Name string `json:"name"`
+	}{}
+	if err = jenkins.get(context.Background(), "/whoAmI", nil, &whoAmI); err != nil {
+		return
+	}
 
-// GetQueueItem returns a single queue item
-func (jenkins *Jenkins) GetQueueItem(itemNo int) (item Item, err error) {
-	err = jenkins.get(fmt.Sprintf("/queue/item/%s", itemNo), nil, &item)
+	user = whoAmI.User
+	user.Id = whoAmI.Name
+	if user.Anonymous {
+		return
+	}
+	err = jenkins.get(context.Background(), "/me", nil, &user)
 	return
 }
 
-// GetArtifact return the content of a build artifact
-func (jenkins *Jenkins) GetArtifact(build Build, artifact Artifact) ([]byte, error) {
-	requestUrl := fmt.Sprintf("%s/artifact/%s", build.Url, artifact.RelativePath)
-	req, err := http.NewRequest("GET", requestUrl, nil)
-	if err != nil {
-		return nil, err
-	}
+// GetJobs returns all jobs you can read.
+func (jenkins *Jenkins) GetJobs() ([]Job, error) {
+	return jenkins.GetJobsContext(context.Background())
+}
 
-	res, err := jenkins.sendRequest(req)
-	if err != nil {
+// GetJobsContext is like GetJobs but carries ctx through the request.
+func (jenkins *Jenkins) GetJobsContext(ctx context.Context) ([]Job, error) {
+	var payload = struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	err := jenkins.get(ctx, "", nil, &payload)
+	return payload.Jobs, err
+}
+
+// GetJobsWithLastBuild returns all jobs with the number, result, timestamp and duration of their
+// last build. Selecting the fields with the tree query parameter fetches everything in one request,
+// instead of one GetBuild request per job.
+func (jenkins *Jenkins) GetJobsWithLastBuild() ([]Job, error) {
+	var payload = struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	params := url.Values{"tree": []string{"jobs[name,url,color,lastBuild[number,result,timestamp,duration]]"}}
+	err := jenkins.get(context.Background(), "", params, &payload)
+	return payload.Jobs, err
+}
+
+// GetJobsRecursive returns all jobs you can read, descending into folders.
+// The name of each returned job is its full path, e.g. "folderA/folderB/jobName".
+func (jenkins *Jenkins) GetJobsRecursive() ([]Job, error) {
+	jobs, err := jenkins.GetJobs()
+	if err != nil {
+		return nil, err
+	}
+	return jenkins.expandFolders(context.Background(), "", jobs)
+}
+
+// expandFolders replaces the folders among jobs, whose names are relative to prefix, with their contents.
+func (jenkins *Jenkins) expandFolders(ctx context.Context, prefix string, jobs []Job) ([]Job, error) {
+	var expanded []Job
+	for _, job := range jobs {
+		job.Name = prefix + job.Name
+		if !job.IsFolder() {
+			expanded = append(expanded, job)
+			continue
+		}
+
+		var payload = struct {
+			Jobs []Job `json:"jobs"`
+		}{}
+		if err := jenkins.getUrl(ctx, objectApiUrl(job.Url, nil), &payload); err != nil {
+			return nil, err
+		}
+		children, err := jenkins.expandFolders(ctx, job.Name+"/", payload.Jobs)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, children...)
+	}
+	return expanded, nil
+}
+
+// GetBranchJobs returns the branch jobs of a multibranch pipeline project.
+// The name of each returned job is its full path, e.g. "project/feature%2Ffoo", as multibranch
+// projects escape the slashes of branch names in job names.
+func (jenkins *Jenkins) GetBranchJobs(projectName string) ([]Job, error) {
+	var payload = struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	if err := jenkins.get(context.Background(), jobPath(projectName), nil, &payload); err != nil {
+		return nil, err
+	}
+
+	for i := range payload.Jobs {
+		payload.Jobs[i].Name = strings.Trim(projectName, "/") + "/" + payload.Jobs[i].Name
+	}
+	return payload.Jobs, nil
+}
+
+// ScanMultibranch triggers branch indexing of a multibranch pipeline project, discovering
+// new branches and removing deleted ones.
+func (jenkins *Jenkins) ScanMultibranch(projectName string) error {
+	params := url.Values{"delay": []string{"0"}}
+	return jenkins.post(context.Background(), fmt.Sprintf("%s/build", jobPath(projectName)), params, nil)
+}
+
+// GetJobsRange returns the jobs from index from (inclusive) to index to (exclusive), with only their
+// name, url and color set, so large instances can be paged through.
+// Jenkins does not report the total number of jobs; a page shorter than requested is the last one.
+func (jenkins *Jenkins) GetJobsRange(from, to int) ([]Job, error) {
+	var payload = struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	err := jenkins.GetWithTree("", fmt.Sprintf("jobs[name,url,color]{%d,%d}", from, to), &payload)
+	return payload.Jobs, err
+}
+
+// GetJob returns a job which has specified name.
+func (jenkins *Jenkins) GetJob(name string) (job Job, err error) {
+	return jenkins.GetJobContext(context.Background(), name)
+}
+
+// GetJobContext is like GetJob but carries ctx through the request.
+func (jenkins *Jenkins) GetJobContext(ctx context.Context, name string) (job Job, err error) {
+	err = jenkins.get(ctx, jobPath(name), nil, &job)
+	return
+}
+
+// GetJobByUrl returns the job at jobUrl, e.g. the Url of a job listed by a view, which saves
+// working out the full name of jobs inside folders. jobUrl must belong to this Jenkins.
+func (jenkins *Jenkins) GetJobByUrl(jobUrl string) (job Job, err error) {
+	if err = jenkins.checkOwnUrl(jobUrl); err != nil {
+		return
+	}
+	err = jenkins.getUrl(context.Background(), objectApiUrl(jobUrl, nil), &job)
+	return
+}
+
+// checkOwnUrl returns an error unless objectUrl is below the base url of Jenkins, so that
+// credentials are not sent elsewhere.
+func (jenkins *Jenkins) checkOwnUrl(objectUrl string) error {
+	base, err := url.Parse(jenkins.baseUrl)
+	if err != nil {
+		return err
+	}
+	object, err := url.Parse(objectUrl)
+	if err != nil {
+		return err
+	}
+
+	basePath := strings.TrimSuffix(base.Path, "/") + "/"
+	if !strings.EqualFold(object.Scheme, base.Scheme) || !strings.EqualFold(object.Host, base.Host) ||
+		!strings.HasPrefix(strings.TrimSuffix(object.Path, "/")+"/", basePath) {
+		return fmt.Errorf("jenkins: %s is not a url of %s", objectUrl, jenkins.baseUrl)
+	}
+	return nil
+}
+
+// GetJobHealth returns the health reports of the named job, e.g. its build stability.
+func (jenkins *Jenkins) GetJobHealth(name string) ([]Health, error) {
+	var job Job
+	params := url.Values{"tree": []string{"healthReport[description,score,iconClassName,iconUrl]"}}
+	err := jenkins.get(context.Background(), jobPath(name), params, &job)
+	return job.HealthReport, err
+}
+
+// GetJobDescription returns the description of the job which has specified name.
+func (jenkins *Jenkins) GetJobDescription(name string) (string, error) {
+	var job Job
+	err := jenkins.GetWithTree(jobPath(name), "description", &job)
+	return job.Description, err
+}
+
+// SetJobDescription replaces the description of the job which has specified name.
+func (jenkins *Jenkins) SetJobDescription(name, description string) error {
+	form := url.Values{"description": []string{description}}
+	return jenkins.postForm(context.Background(), fmt.Sprintf("%s/description", jobPath(name)), form, nil)
+}
+
+// GetJobParameters returns the definitions of the parameters the job which has specified name accepts.
+func (jenkins *Jenkins) GetJobParameters(name string) ([]ParameterDefinition, error) {
+	var payload = struct {
+		Property []struct {
+			ParameterDefinitions []ParameterDefinition `json:"parameterDefinitions"`
+		} `json:"property"`
+	}{}
+	tree := "property[parameterDefinitions[name,type,description,defaultParameterValue[name,value],choices]]"
+	if err := jenkins.GetWithTree(jobPath(name), tree, &payload); err != nil {
+		return nil, err
+	}
+
+	var definitions []ParameterDefinition
+	for _, property := range payload.Property {
+		definitions = append(definitions, property.ParameterDefinitions...)
+	}
+	return definitions, nil
+}
+
+//GetJobConfig returns a maven job, has the one used to create Maven job
+func (jenkins *Jenkins) GetJobConfig(name string) (job MavenJobItem, err error) {
+	config, err := jenkins.GetJobConfigXML(name)
+	if err != nil {
+		return
+	}
+	err = unmarshalXml(config, &job)
+	return
+}
+
+// GetJobConfigXML returns the config.xml of a job, whatever the kind of job.
+func (jenkins *Jenkins) GetJobConfigXML(name string) ([]byte, error) {
+	res, err := jenkins.getRaw(context.Background(), jenkins.buildRawUrl(fmt.Sprintf("%s/config.xml", jobPath(name)), nil))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// GetJobAssignedNode returns the label expression restricting where the named job can run,
+// or an empty string if it can run on any node.
+func (jenkins *Jenkins) GetJobAssignedNode(name string) (string, error) {
+	config, err := jenkins.GetJobConfigXML(name)
+	if err != nil {
+		return "", err
+	}
+
+	// The root element depends on the kind of job, so only assignedNode is matched.
+	var job struct {
+		AssignedNode string `xml:"assignedNode"`
+	}
+	if err = unmarshalXml(config, &job); err != nil {
+		return "", err
+	}
+	return job.AssignedNode, nil
+}
+
+// GetBuild returns a number-th build result of specified job.
+func (jenkins *Jenkins) GetBuild(job Job, number int) (build Build, err error) {
+	return jenkins.GetBuildContext(context.Background(), job, number)
+}
+
+// GetBuildContext is like GetBuild but carries ctx through the request.
+func (jenkins *Jenkins) GetBuildContext(ctx context.Context, job Job, number int) (build Build, err error) {
+	err = jenkins.get(ctx, fmt.Sprintf("%s/%d", jobPath(job.Name), number), nil, &build)
+	return
+}
+
+// GetAllBuildsAcrossJobs returns the limit most recent builds of every top-level job, keyed by job name,
+// in a single request like GetJobBuilds. tree selects the build fields to fetch, such as
+// "number,result,timestamp"; when empty, the fields GetJobBuilds fetches are used.
+func (jenkins *Jenkins) GetAllBuildsAcrossJobs(tree string, limit int) (map[string][]Build, error) {
+	if tree == "" {
+		tree = "number,result,timestamp,duration,url"
+	}
+	var payload = struct {
+		Jobs []Job `json:"jobs"`
+	}{}
+	if err := jenkins.GetWithTree("", fmt.Sprintf("jobs[name,builds[%s]{0,%d}]", tree, limit), &payload); err != nil {
+		return nil, err
+	}
+
+	builds := make(map[string][]Build, len(payload.Jobs))
+	for _, job := range payload.Jobs {
+		builds[job.Name] = job.Builds
+	}
+	return builds, nil
+}
+
+// IsBuilding reports whether the number-th build of specified job is still running.
+// Only the building field is fetched, so it is cheaper than GetBuild for polling.
+func (jenkins *Jenkins) IsBuilding(job Job, number int) (bool, error) {
+	build, err := jenkins.GetBuildWithParams(job, number, url.Values{"tree": []string{"building"}})
+	return build.Building, err
+}
+
+// GetBuildWithParams is like GetBuild but sends params, such as tree or depth, with the request
+// to select what Jenkins returns.
+func (jenkins *Jenkins) GetBuildWithParams(job Job, number int, params url.Values) (build Build, err error) {
+	err = jenkins.get(context.Background(), fmt.Sprintf("%s/%d", jobPath(job.Name), number), params, &build)
+	return
+}
+
+// GetBuildByUrl returns the build at buildUrl, e.g. the UpstreamUrl of a cause or the Url of a
+// queue item's Executable. buildUrl must belong to this Jenkins.
+func (jenkins *Jenkins) GetBuildByUrl(buildUrl string) (build Build, err error) {
+	if err = jenkins.checkOwnUrl(buildUrl); err != nil {
+		return
+	}
+	err = jenkins.getUrl(context.Background(), objectApiUrl(buildUrl, nil), &build)
+	return
+}
+
+// GetJobBuilds returns the limit most recent builds of specified job.
+//
+// Rather than fetching every build separately, it asks for the builds as part of the job using the
+// tree query parameter, which selects the fields Jenkins serializes and, with the {from,to} suffix,
+// the range of builds. This makes it a single request no matter how many builds are returned.
+func (jenkins *Jenkins) GetJobBuilds(job Job, limit int) ([]Build, error) {
+	var payload = struct {
+		Builds []Build `json:"builds"`
+	}{}
+	tree := fmt.Sprintf("builds[number,result,timestamp,duration,url]{0,%d}", limit)
+	err := jenkins.GetWithTree(jobPath(job.Name), tree, &payload)
+	return payload.Builds, err
+}
+
+// GetLastBuild returns the most recent build of specified job.
+func (jenkins *Jenkins) GetLastBuild(job Job) (Build, error) {
+	return jenkins.getPermalinkBuild(job, "lastBuild")
+}
+
+// GetLastBuildNumber returns the number of the most recent build of specified job.
+// It returns ErrNoBuilds when the job has never built.
+func (jenkins *Jenkins) GetLastBuildNumber(job Job) (int, error) {
+	var payload struct {
+		LastBuild *Build `json:"lastBuild"`
+	}
+	params := url.Values{"tree": []string{"lastBuild[number]"}}
+	if err := jenkins.get(context.Background(), jobPath(job.Name), params, &payload); err != nil {
+		return 0, err
+	}
+	if payload.LastBuild == nil {
+		return 0, ErrNoBuilds
+	}
+	return payload.LastBuild.Number, nil
+}
+
+// GetLastSuccessfulBuild returns the most recent successful build of specified job.
+func (jenkins *Jenkins) GetLastSuccessfulBuild(job Job) (Build, error) {
+	return jenkins.getPermalinkBuild(job, "lastSuccessfulBuild")
+}
+
+// GetLastFailedBuild returns the most recent failed build of specified job.
+func (jenkins *Jenkins) GetLastFailedBuild(job Job) (Build, error) {
+	return jenkins.getPermalinkBuild(job, "lastFailedBuild")
+}
+
+// GetLastStableBuild returns the most recent stable build of specified job.
+func (jenkins *Jenkins) GetLastStableBuild(job Job) (Build, error) {
+	return jenkins.getPermalinkBuild(job, "lastStableBuild")
+}
+
+// getPermalinkBuild returns the build a job permalink points at, or ErrNoBuilds when it points at none.
+func (jenkins *Jenkins) getPermalinkBuild(job Job, permalink string) (build Build, err error) {
+	err = jenkins.get(context.Background(), fmt.Sprintf("%s/%s", jobPath(job.Name), permalink), nil, &build)
+	if isStatus(err, http.StatusNotFound) {
+		err = ErrNoBuilds
+	}
+	return
+}
+
+// Create a new job
+func (jenkins *Jenkins) CreateJob(mavenJobItem MavenJobItem, jobName string) error {
+	mavenJobItemXml, _ := xml.Marshal(mavenJobItem)
+	return jenkins.CreateJobWithXML(jobName, bytes.NewReader(mavenJobItemXml))
+}
+
+// CreatePipelineJob creates a new pipeline job.
+func (jenkins *Jenkins) CreatePipelineJob(pipelineJobItem PipelineJobItem, jobName string) error {
+	pipelineJobItemXml, err := xml.Marshal(pipelineJobItem)
+	if err != nil {
+		return err
+	}
+	return jenkins.CreateJobWithXML(jobName, bytes.NewReader(pipelineJobItemXml))
+}
+
+// CreateJobWithXML creates a new job from its config.xml, whatever the kind of job.
+// name may be the path of a job inside a folder, such as "team/deploy".
+func (jenkins *Jenkins) CreateJobWithXML(name string, config io.Reader) error {
+	parentPath, name := splitJobName(name)
+	params := url.Values{"name": []string{name}}
+	return jenkins.postXml(context.Background(), parentPath+"/createItem", params, config, nil)
+}
+
+// UpdateJobConfigXML replaces the config.xml of the named job.
+func (jenkins *Jenkins) UpdateJobConfigXML(name string, config io.Reader) error {
+	return jenkins.postXml(context.Background(), fmt.Sprintf("%s/config.xml", jobPath(name)), nil, config, nil)
+}
+
+// EnsureJob applies config to the named job, creating the job if it does not exist yet,
+// and reports whether it did.
+func (jenkins *Jenkins) EnsureJob(name string, config io.Reader) (created bool, err error) {
+	// The config may have to be sent twice, so it is read up front.
+	data, err := ioutil.ReadAll(config)
+	if err != nil {
+		return
+	}
+
+	err = jenkins.UpdateJobConfigXML(name, bytes.NewReader(data))
+	if !isStatus(err, http.StatusNotFound) {
+		return
+	}
+	if err = jenkins.CreateJobWithXML(name, bytes.NewReader(data)); err != nil {
+		return
+	}
+	return true, nil
+}
+
+// splitJobName splits the name of a job into the url path of its parent folder, empty at the top
+// level, and its own name.
+func splitJobName(name string) (parentPath, base string) {
+	name = strings.Trim(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return jobPath(name[:i]), name[i+1:]
+	}
+	return "", name
+}
+
+// CreateFolder creates a new folder. name may be the path of a folder inside another folder,
+// such as "team/services".
+func (jenkins *Jenkins) CreateFolder(name string) error {
+	parentPath, name := splitJobName(name)
+	params := url.Values{"name": []string{name}, "mode": []string{FolderClass}}
+	return jenkins.post(context.Background(), parentPath+"/createItem", params, nil)
+}
+
+// GetFolder returns the folder at path, such as "team/services", with the jobs it holds.
+func (jenkins *Jenkins) GetFolder(path string) (folder Folder, err error) {
+	err = jenkins.get(context.Background(), jobPath(path), nil, &folder)
+	return
+}
+
+// CopyJob creates a new job named targetName as a copy of the job named sourceName.
+// Both names may be paths of jobs inside folders, such as "team/deploy".
+func (jenkins *Jenkins) CopyJob(sourceName, targetName string) error {
+	parentPath, name := splitJobName(targetName)
+	// from is resolved relative to the target folder unless it is absolute.
+	from := "/" + strings.Trim(sourceName, "/")
+	params := url.Values{"name": []string{name}, "mode": []string{"copy"}, "from": []string{from}}
+	err := jenkins.post(context.Background(), parentPath+"/createItem", params, nil)
+	if isStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("jenkins: cannot copy job %s to %s, the source is missing or the target exists: %w", sourceName, targetName, err)
+	}
+	return err
+}
+
+// RenameJob renames the job named oldName to newName, keeping its build history.
+func (jenkins *Jenkins) RenameJob(oldName, newName string) error {
+	params := url.Values{"newName": []string{newName}}
+	err := jenkins.post(context.Background(), fmt.Sprintf("%s/doRename", jobPath(oldName)), params, nil)
+	if isStatus(err, http.StatusBadRequest) {
+		return fmt.Errorf("jenkins: cannot rename job %s to %s, the new name may already be taken: %w", oldName, newName, err)
+	}
+	return err
+}
+
+// WipeoutWorkspace deletes the workspace of specified job.
+// Jenkins refuses to do so while the job is building, in which case an error is returned.
+func (jenkins *Jenkins) WipeoutWorkspace(job Job) error {
+	var payload struct {
+		LastBuild *Build `json:"lastBuild"`
+	}
+	params := url.Values{"tree": []string{"lastBuild[building]"}}
+	if err := jenkins.get(context.Background(), jobPath(job.Name), params, &payload); err != nil {
+		return err
+	}
+	if payload.LastBuild != nil && payload.LastBuild.Building {
+		return fmt.Errorf("jenkins: cannot wipe out the workspace of %s while it is building", job.Name)
+	}
+
+	return jenkins.post(context.Background(), fmt.Sprintf("%s/doWipeOutWorkspace", jobPath(job.Name)), nil, nil)
+}
+
+// DeleteJob deletes the job which has specified name.
+func (jenkins *Jenkins) DeleteJob(name string) error {
+	err := jenkins.post(context.Background(), fmt.Sprintf("%s/doDelete", jobPath(name)), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("jenkins: job %s does not exist: %w", name, err)
+	}
+	return err
+}
+
+// Add job to view
+func (jenkins *Jenkins) AddJobToView(viewName string, job Job) error {
+	params := url.Values{"name": []string{job.Name}}
+	return jenkins.post(context.Background(), viewPath(viewName)+"/addJobToView", params, nil)
+}
+
+// Remove job from view
+// Removing a job which is not in the view is not an error.
+func (jenkins *Jenkins) RemoveJobFromView(viewName string, job Job) error {
+	params := url.Values{"name": []string{job.Name}}
+	err := jenkins.post(context.Background(), viewPath(viewName)+"/removeJobFromView", params, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("jenkins: view %s does not exist: %w", viewName, err)
+	}
+	return err
+}
+
+// GetView returns a view which has specified name.
+func (jenkins *Jenkins) GetView(name string) (view View, err error) {
+	err = jenkins.get(context.Background(), viewPath(name), nil, &view)
+	return
+}
+
+// GetViewConfigXML returns the config.xml of the view which has specified name.
+func (jenkins *Jenkins) GetViewConfigXML(name string) ([]byte, error) {
+	res, err := jenkins.getRaw(context.Background(), jenkins.buildRawUrl(viewPath(name)+"/config.xml", nil))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// GetListView returns the configuration of the list view which has specified name.
+func (jenkins *Jenkins) GetListView(name string) (view ListView, err error) {
+	config, err := jenkins.GetViewConfigXML(name)
+	if err != nil {
+		return
+	}
+	err = unmarshalXml(config, &view)
+	return
+}
+
+// UpdateViewConfigXML replaces the config.xml of the view which has specified name.
+func (jenkins *Jenkins) UpdateViewConfigXML(name string, config io.Reader) error {
+	return jenkins.postXml(context.Background(), viewPath(name)+"/config.xml", nil, config, nil)
+}
+
+// DeleteView deletes the view which has specified name.
+func (jenkins *Jenkins) DeleteView(name string) error {
+	return jenkins.post(context.Background(), viewPath(name)+"/doDelete", nil, nil)
+}
+
+// Create a new view
+func (jenkins *Jenkins) CreateView(listView ListView) error {
+	xmlListView, _ := xml.Marshal(listView)
+	reader := bytes.NewReader(xmlListView)
+	params := url.Values{"name": []string{listView.Name}}
+
+	return jenkins.postXml(context.Background(), "/createView", params, reader, nil)
+}
+
+// Create a new build for this job.
+// Params can be nil.
+func (jenkins *Jenkins) Build(job Job, params url.Values) (item Item, err error) {
+	return jenkins.BuildContext(context.Background(), job, params)
+}
+
+// BuildContext is like Build but carries ctx through the request.
+func (jenkins *Jenkins) BuildContext(ctx context.Context, job Job, params url.Values) (item Item, err error) {
+	return jenkins.triggerBuild(ctx, job, params, nil)
+}
+
+// BuildWithDelay is like Build but overrides the quiet period of specified job with delay.
+func (jenkins *Jenkins) BuildWithDelay(job Job, params url.Values, delay time.Duration) (item Item, err error) {
+	options := url.Values{"delay": []string{fmt.Sprintf("%dsec", int64(delay/time.Second))}}
+	return jenkins.triggerBuild(context.Background(), job, params, options)
+}
+
+// BuildWithToken is like Build but authorizes the trigger with the remote build token of
+// specified job, and records cause, if not empty, as the cause of the build.
+func (jenkins *Jenkins) BuildWithToken(job Job, params url.Values, token, cause string) (item Item, err error) {
+	options := url.Values{"token": []string{token}}
+	if cause != "" {
+		options.Set("cause", cause)
+	}
+	return jenkins.triggerBuild(context.Background(), job, params, options)
+}
+
+// BuildWithJSONParameters is like Build but sends params as the structured json form field of
+// the build endpoint, which can express values such as multi-select choices that Build cannot.
+func (jenkins *Jenkins) BuildWithJSONParameters(job Job, params []BuildParameter) (item Item, err error) {
+	if params == nil {
+		params = []BuildParameter{}
+	}
+	payload, err := json.Marshal(map[string][]BuildParameter{"parameter": params})
+	if err != nil {
+		return
+	}
+
+	form := url.Values{"json": []string{string(payload)}}
+	err = jenkins.postForm(context.Background(), fmt.Sprintf("%s/build", jobPath(job.Name)), form, &item)
+	return
+}
+
+// BuildWithFileParameters is like Build but also uploads files, keyed by the name of the file
+// parameter each is the value of.
+func (jenkins *Jenkins) BuildWithFileParameters(job Job, params url.Values, files map[string]io.Reader) (item Item, err error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	// The json field describes every parameter; file parameters refer to the part holding their content.
+	parameters := []map[string]interface{}{}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range params[name] {
+			parameters = append(parameters, map[string]interface{}{"name": name, "value": value})
+		}
+	}
+	names = make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		part := fmt.Sprintf("file%d", i)
+		parameters = append(parameters, map[string]interface{}{"name": name, "file": part})
+
+		fileWriter, err := writer.CreateFormFile(part, name)
+		if err != nil {
+			return item, err
+		}
+		if _, err = io.Copy(fileWriter, files[name]); err != nil {
+			return item, err
+		}
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"parameter": parameters})
+	if err != nil {
+		return
+	}
+	if err = writer.WriteField("json", string(payload)); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	resp, err := jenkins.request(ctx, "POST", jenkins.buildRawUrl(fmt.Sprintf("%s/build", jobPath(job.Name)), nil), writer.FormDataContentType(), &body)
+	if err != nil {
+		return
+	}
+	err = jenkins.parseQueueItemResponse(ctx, resp, &item)
+	return
+}
+
+// triggerBuild posts to the build endpoint of specified job. options are trigger options such
+// as the delay, which are sent along with params but do not make the build a parameterized one.
+func (jenkins *Jenkins) triggerBuild(ctx context.Context, job Job, params url.Values, options url.Values) (item Item, err error) {
+	endpoint := "build"
+	if params != nil {
+		endpoint = "buildWithParameters"
+	}
+
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	for key, values := range options {
+		query[key] = values
+	}
+	err = jenkins.post(ctx, fmt.Sprintf("%s/%s", jobPath(job.Name), endpoint), query, &item)
+	return
+}
+
+// SetBuildDescription replaces the description of the number-th build of specified job.
+func (jenkins *Jenkins) SetBuildDescription(job Job, number int, description string) error {
+	form := url.Values{"description": []string{description}}
+	return jenkins.postForm(context.Background(), fmt.Sprintf("%s/%d/submitDescription", jobPath(job.Name), number), form, nil)
+}
+
+// SetBuildDisplayName replaces the display name of the number-th build of specified job,
+// which is shown instead of "#number".
+func (jenkins *Jenkins) SetBuildDisplayName(job Job, number int, displayName string) error {
+	// The build configuration form sets the description along with the display name, so the
+	// current description is sent back unchanged.
+	build, err := jenkins.GetBuild(job, number)
+	if err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(map[string]string{"displayName": displayName, "description": build.Description})
+	if err != nil {
+		return err
+	}
+	form := url.Values{"json": []string{string(config)}}
+	return jenkins.postForm(context.Background(), fmt.Sprintf("%s/%d/configSubmit", jobPath(job.Name), number), form, nil)
+}
+
+// BuildValidated is like Build, but first checks params against the parameter definitions of
+// specified job and returns an error, without triggering a build, if it names parameters the job
+// does not define or lacks parameters which have no default value.
+func (jenkins *Jenkins) BuildValidated(job Job, params url.Values) (item Item, err error) {
+	definitions, err := jenkins.GetJobParameters(job.Name)
+	if err != nil {
+		return
+	}
+
+	defined := map[string]bool{}
+	var missing, unknown []string
+	for _, definition := range definitions {
+		defined[definition.Name] = true
+		if _, ok := params[definition.Name]; !ok && definition.DefaultParameterValue == nil {
+			missing = append(missing, definition.Name)
+		}
+	}
+	for name := range params {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(missing) > 0 || len(unknown) > 0 {
+		sort.Strings(unknown)
+		return item, fmt.Errorf("jenkins: invalid parameters for %s: unknown %v, missing %v", job.Name, unknown, missing)
+	}
+	return jenkins.Build(job, params)
+}
+
+// PollSCM makes specified job poll its SCM now, starting a build only if there are changes.
+// It returns ErrJobDisabled for disabled jobs and an error when the job does not poll its SCM.
+func (jenkins *Jenkins) PollSCM(job Job) error {
+	err := jenkins.post(context.Background(), fmt.Sprintf("%s/polling", jobPath(job.Name)), nil, nil)
+	switch {
+	case isStatus(err, http.StatusConflict):
+		return ErrJobDisabled
+	case isStatus(err, http.StatusNotFound):
+		return fmt.Errorf("jenkins: job %s does not exist or has no SCM polling trigger: %w", job.Name, err)
+	}
+	return err
+}
+
+// DeleteBuild deletes the number-th build of specified job.
+// It returns ErrNoBuilds when the job has no such build.
+func (jenkins *Jenkins) DeleteBuild(job Job, number int) error {
+	err := jenkins.post(context.Background(), fmt.Sprintf("%s/%d/doDelete", jobPath(job.Name), number), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return ErrNoBuilds
+	}
+	return err
+}
+
+// ToggleKeepBuild flips whether the number-th build of specified job is kept forever,
+// i.e. exempt from build discarding. The current state is the KeepLog field of Build.
+func (jenkins *Jenkins) ToggleKeepBuild(job Job, number int) error {
+	return jenkins.post(context.Background(), fmt.Sprintf("%s/%d/toggleLogKeep", jobPath(job.Name), number), nil, nil)
+}
+
+// SetKeepBuild sets whether the number-th build of specified job is kept forever,
+// toggling it only when it is not in that state already.
+func (jenkins *Jenkins) SetKeepBuild(job Job, number int, keep bool) error {
+	build, err := jenkins.GetBuildWithParams(job, number, url.Values{"tree": []string{"keepLog"}})
+	if err != nil {
+		return err
+	}
+	if build.KeepLog == keep {
+		return nil
+	}
+	return jenkins.ToggleKeepBuild(job, number)
+}
+
+// StopBuild aborts the number-th build of specified job.
+// Stopping a build which has already finished is not an error.
+func (jenkins *Jenkins) StopBuild(job Job, number int) error {
+	return jenkins.post(context.Background(), fmt.Sprintf("%s/%d/stop", jobPath(job.Name), number), nil, nil)
+}
+
+// KillBuild hard-kills the number-th build of specified job.
+// Use it for builds which do not respond to StopBuild.
+func (jenkins *Jenkins) KillBuild(job Job, number int) error {
+	return jenkins.post(context.Background(), fmt.Sprintf("%s/%d/kill", jobPath(job.Name), number), nil, nil)
+}
+
+// GetBuildConsoleTail returns at most the last maxBytes bytes of the console output of a build,
+// without downloading the rest of it.
+func (jenkins *Jenkins) GetBuildConsoleTail(build Build, maxBytes int64) ([]byte, error) {
+	// A HEAD request tells the size of the output in the X-Text-Size header without sending it.
+	requestUrl := fmt.Sprintf("%s/logText/progressiveText?start=0", build.Url)
+	res, err := jenkins.request(context.Background(), "HEAD", requestUrl, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	var start int64
+	if size, err := strconv.ParseInt(res.Header.Get("X-Text-Size"), 10, 64); err == nil && size > maxBytes {
+		start = size - maxBytes
+	}
+	text, _, _, err := jenkins.GetBuildConsoleOutputProgressive(build, start)
+	if err != nil {
+		return nil, err
+	}
+	// The output may have grown since its size was asked for.
+	if int64(len(text)) > maxBytes {
+		text = text[int64(len(text))-maxBytes:]
+	}
+	return text, nil
+}
+
+// Get the console output from a build.
+func (jenkins *Jenkins) GetBuildConsoleOutput(build Build) ([]byte, error) {
+	return jenkins.GetBuildConsoleOutputContext(context.Background(), build)
+}
+
+// GetBuildConsoleOutputContext is like GetBuildConsoleOutput but carries ctx through the request.
+// Cancelling ctx also stops reading the output, e.g. of a build which is still running.
+func (jenkins *Jenkins) GetBuildConsoleOutputContext(ctx context.Context, build Build) ([]byte, error) {
+	res, err := jenkins.getRaw(ctx, fmt.Sprintf("%s/consoleText", build.Url))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// GetBuildConsoleOutputStream returns the console output of a build as a stream.
+// The caller must close it.
+func (jenkins *Jenkins) GetBuildConsoleOutputStream(build Build) (io.ReadCloser, error) {
+	requestUrl := fmt.Sprintf("%s/consoleText", build.Url)
+	res, err := jenkins.getRaw(context.Background(), requestUrl)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// GetBuildConsoleOutputProgressive returns the console output of a build starting at byte offset start.
+// moreData reports whether the build is still writing output, and nextStart is the offset to pass
+// to the next call to continue tailing the log.
+func (jenkins *Jenkins) GetBuildConsoleOutputProgressive(build Build, start int64) (text []byte, moreData bool, nextStart int64, err error) {
+	requestUrl := fmt.Sprintf("%s/logText/progressiveText?start=%d", build.Url, start)
+	res, err := jenkins.getRaw(context.Background(), requestUrl)
+	if err != nil {
+		return
+	}
+
+	defer res.Body.Close()
+	if text, err = ioutil.ReadAll(res.Body); err != nil {
+		return
+	}
+
+	moreData = res.Header.Get("X-More-Data") == "true"
+	nextStart = start + int64(len(text))
+	if size := res.Header.Get("X-Text-Size"); size != "" {
+		if nextStart, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// StreamConsole copies the console output of a build to w as it is written, returning once the build
+// has finished writing output.
+func (jenkins *Jenkins) StreamConsole(build Build, w io.Writer) error {
+	var start int64
+	for {
+		text, moreData, nextStart, err := jenkins.GetBuildConsoleOutputProgressive(build, start)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(text); err != nil {
+			return err
+		}
+		if !moreData {
+			return nil
+		}
+
+		start = nextStart
+		time.Sleep(jenkins.ConsolePollInterval)
+	}
+}
+
+// GetQueue returns the current build queue from Jenkins
+func (jenkins *Jenkins) GetQueue() (queue Queue, err error) {
+	err = jenkins.get(context.Background(), fmt.Sprintf("/queue"), nil, &queue)
+	return
+}
+
+// GetQueueLength returns how many items are waiting in the build queue.
+// Only their ids are fetched, so it is cheaper than GetQueue for metrics.
+func (jenkins *Jenkins) GetQueueLength() (int, error) {
+	var queue Queue
+	err := jenkins.get(context.Background(), "/queue", url.Values{"tree": []string{"items[id]"}}, &queue)
+	return len(queue.Items), err
+}
+
+// WatchQueue polls the build queue every interval and sends each snapshot on the returned
+// queue channel. Failed polls are sent on the error channel and do not stop the watcher.
+// Both channels are closed once ctx is done.
+func (jenkins *Jenkins) WatchQueue(ctx context.Context, interval time.Duration) (<-chan Queue, <-chan error) {
+	queues := make(chan Queue)
+	errs := make(chan error)
+
+	go func() {
+		defer close(queues)
+		defer close(errs)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var queue Queue
+			if err := jenkins.get(ctx, "/queue", nil, &queue); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				select {
+				case queues <- queue:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return queues, errs
+}
+
+// GetQueueForJob returns the queued items of specified job.
+// Items are matched on the job url, which is derived from the job name when job has none.
+func (jenkins *Jenkins) GetQueueForJob(job Job) ([]Item, error) {
+	queue, err := jenkins.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	// The name of a task is the short name of its job, which jobs in different folders share.
+	jobUrl := job.Url
+	if jobUrl == "" {
+		jobUrl = jenkins.baseUrl + jobPath(job.Name) + "/"
+	}
+	var items []Item
+	for _, item := range queue.Items {
+		if item.Task.Url == jobUrl {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// GetQueueItem returns a single queue item
+func (jenkins *Jenkins) GetQueueItem(itemNo int) (item Item, err error) {
+	err = jenkins.get(context.Background(), fmt.Sprintf("/queue/item/%d", itemNo), nil, &item)
+	return
+}
+
+// GetBuildNumberFromQueueItem returns the number of the build a queue item turned into.
+// item is fetched again unless it already has its build. It returns ErrQueueItemPending while
+// the item is still waiting and ErrQueueItemCancelled if it has been cancelled.
+func (jenkins *Jenkins) GetBuildNumberFromQueueItem(item Item) (int, error) {
+	if item.Executable.Number == 0 && !item.Cancelled {
+		var err error
+		if item, err = jenkins.GetQueueItem(item.Id); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case item.Cancelled:
+		return 0, ErrQueueItemCancelled
+	case item.Executable.Number == 0:
+		return 0, ErrQueueItemPending
+	}
+	return item.Executable.Number, nil
+}
+
+// WaitForBuildFromQueue polls a queue item, such as the one returned by Build, every pollInterval
+// until Jenkins starts building it and returns that build.
+// It returns ErrQueueItemCancelled if the item is cancelled and ErrTimeout if the build has not
+// started within timeout.
+func (jenkins *Jenkins) WaitForBuildFromQueue(item Item, pollInterval, timeout time.Duration) (build Build, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if item.Cancelled {
+			return build, ErrQueueItemCancelled
+		}
+		if item.Executable.Url != "" {
+			err = jenkins.getUrl(context.Background(), objectApiUrl(item.Executable.Url, nil), &build)
+			return
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return build, ErrTimeout
+		}
+
+		time.Sleep(pollInterval)
+		if item, err = jenkins.GetQueueItem(item.Id); err != nil {
+			return
+		}
+	}
+}
+
+// WaitForBuild polls the number-th build of specified job every pollInterval until it finishes and
+// returns the finished build, whose Result is then set.
+// It returns ErrTimeout, along with the last fetched build, if the build is still running after timeout.
+func (jenkins *Jenkins) WaitForBuild(job Job, number int, pollInterval, timeout time.Duration) (build Build, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if build, err = jenkins.GetBuild(job, number); err != nil || !build.Building {
+			return
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return build, ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// TriggerAndWait triggers a build of specified job, like Build, then waits for it to leave the
+// queue and to finish, polling every pollInterval, and returns the finished build.
+// It returns ErrJobDisabled for disabled jobs, ErrQueueItemCancelled if the build is cancelled
+// while queued and ErrTimeout if the build has not finished within timeout.
+func (jenkins *Jenkins) TriggerAndWait(job Job, params url.Values, pollInterval, timeout time.Duration) (build Build, err error) {
+	deadline := time.Now().Add(timeout)
+	item, err := jenkins.Build(job, params)
+	if isStatus(err, http.StatusConflict) {
+		return build, ErrJobDisabled
+	}
+	if err != nil {
+		return
+	}
+	if item.Id == 0 {
+		return build, fmt.Errorf("jenkins: no queue item was returned for the build of %s", job.Name)
+	}
+
+	if build, err = jenkins.WaitForBuildFromQueue(item, pollInterval, time.Until(deadline)); err != nil {
+		return
+	}
+	return jenkins.WaitForBuild(job, build.Number, pollInterval, time.Until(deadline))
+}
+
+// CancelQueueItem removes a queued item before it starts building.
+// Some Jenkins versions answer a successful cancel with 404, so 404 is not treated as an error.
+func (jenkins *Jenkins) CancelQueueItem(itemNo int) error {
+	params := url.Values{"id": []string{strconv.Itoa(itemNo)}}
+	err := jenkins.post(context.Background(), "/queue/cancelItem", params, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ClearQueue cancels every item in the build queue.
+func (jenkins *Jenkins) ClearQueue() error {
+	queue, err := jenkins.GetQueue()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range queue.Items {
+		if err := jenkins.CancelQueueItem(item.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBuildCauses returns why a build was started, fetching the build again when it carries no actions.
+func (jenkins *Jenkins) GetBuildCauses(build Build) ([]Cause, error) {
+	if len(build.Actions) == 0 {
+		if err := jenkins.getUrl(context.Background(), objectApiUrl(build.Url, nil), &build); err != nil {
+			return nil, err
+		}
+	}
+
+	var causes []Cause
+	for _, action := range build.Actions {
+		causes = append(causes, action.Causes...)
+	}
+	return causes, nil
+}
+
+// GetUpstreamBuilds returns the builds which triggered a build, as recorded in its upstream causes.
+func (jenkins *Jenkins) GetUpstreamBuilds(build Build) ([]Build, error) {
+	causes, err := jenkins.GetBuildCauses(build)
+	if err != nil {
+		return nil, err
+	}
+
+	var builds []Build
+	for _, cause := range causes {
+		if cause.UpstreamUrl == "" {
+			continue
+		}
+		// UpstreamUrl is the job url relative to the root of Jenkins, e.g. "job/build/".
+		buildUrl := fmt.Sprintf("%s/%s%d/", jenkins.baseUrl, strings.TrimPrefix(cause.UpstreamUrl, "/"), cause.UpstreamBuild)
+		var upstream Build
+		if err := jenkins.getUrl(context.Background(), objectApiUrl(buildUrl, nil), &upstream); err != nil {
+			return nil, err
+		}
+		builds = append(builds, upstream)
+	}
+	return builds, nil
+}
+
+// downstreamScanLimit is how many recent builds of each downstream job GetDownstreamBuilds looks at.
+const downstreamScanLimit = 50
+
+// GetDownstreamBuilds returns the builds a build triggered. Jenkins only records the trigger on the
+// triggered builds, so the recent builds of the downstream jobs of the build's job are searched for
+// an upstream cause pointing at the build.
+func (jenkins *Jenkins) GetDownstreamBuilds(build Build) ([]Build, error) {
+	ctx := context.Background()
+	if build.Number == 0 {
+		if err := jenkins.getUrl(ctx, objectApiUrl(build.Url, nil), &build); err != nil {
+			return nil, err
+		}
+	}
+
+	// The job url is the build url without its number.
+	jobUrl := strings.TrimSuffix(strings.TrimSuffix(build.Url, "/"), "/"+strconv.Itoa(build.Number))
+	var job struct {
+		FullName           string `json:"fullName"`
+		DownstreamProjects []Job  `json:"downstreamProjects"`
+	}
+	if err := jenkins.getUrl(ctx, objectApiUrl(jobUrl, url.Values{"tree": []string{"fullName,downstreamProjects[url]"}}), &job); err != nil {
+		return nil, err
+	}
+
+	var builds []Build
+	tree := fmt.Sprintf("builds[number,url,actions[causes[upstreamProject,upstreamBuild]]]{0,%d}", downstreamScanLimit)
+	for _, downstreamJob := range job.DownstreamProjects {
+		var downstream struct {
+			Builds []Build `json:"builds"`
+		}
+		if err := jenkins.getUrl(ctx, objectApiUrl(downstreamJob.Url, url.Values{"tree": []string{tree}}), &downstream); err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range downstream.Builds {
+			if !triggeredBy(candidate, job.FullName, build.Number) {
+				continue
+			}
+			var full Build
+			if err := jenkins.getUrl(ctx, objectApiUrl(candidate.Url, nil), &full); err != nil {
+				return nil, err
+			}
+			builds = append(builds, full)
+		}
+	}
+	return builds, nil
+}
+
+// triggeredBy reports whether build has an upstream cause pointing at the number-th build of the
+// job which has the full name project.
+func triggeredBy(build Build, project string, number int) bool {
+	for _, action := range build.Actions {
+		for _, cause := range action.Causes {
+			if cause.UpstreamProject == project && cause.UpstreamBuild == number {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetFingerprint returns which build produced the file with the given MD5 checksum, and which builds
+// used it. Only files archived or fingerprinted by a build are known to Jenkins.
+func (jenkins *Jenkins) GetFingerprint(md5 string) (fingerprint Fingerprint, err error) {
+	err = jenkins.get(context.Background(), "/fingerprint/"+url.PathEscape(md5), nil, &fingerprint)
+	return
+}
+
+// GetBuildArtifacts returns the artifacts of a build, fetching the build again when it carries none.
+func (jenkins *Jenkins) GetBuildArtifacts(build Build) ([]Artifact, error) {
+	if len(build.Artifacts) > 0 {
+		return build.Artifacts, nil
+	}
+
+	var fetched Build
+	err := jenkins.getUrl(context.Background(), objectApiUrl(build.Url, nil), &fetched)
+	return fetched.Artifacts, err
+}
+
+// GetBuildParameters returns the parameters a build ran with, fetching the build again when it
+// carries no actions. Password parameters are returned with an empty value.
+func (jenkins *Jenkins) GetBuildParameters(build Build) (url.Values, error) {
+	if len(build.Actions) == 0 {
+		if err := jenkins.getUrl(context.Background(), objectApiUrl(build.Url, nil), &build); err != nil {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	for _, action := range build.Actions {
+		for _, parameter := range action.Parameters {
+			switch value := parameter.Value.(type) {
+			case nil:
+				params.Add(parameter.Name, "")
+			case string:
+				params.Add(parameter.Name, value)
+			case bool:
+				params.Add(parameter.Name, strconv.FormatBool(value))
+			default:
+				params.Add(parameter.Name, fmt.Sprint(value))
+			}
+		}
+	}
+	return params, nil
+}
+
+// GetComputers returns the nodes of Jenkins, including the built-in node.
+func (jenkins *Jenkins) GetComputers() ([]Computer, error) {
+	var computers Computers
+	err := jenkins.get(context.Background(), "/computer", nil, &computers)
+	return computers.Computers, err
+}
+
+// GetExecutorStats returns the number of executors across all nodes, how many of them are busy
+// and how many items are waiting in the build queue.
+func (jenkins *Jenkins) GetExecutorStats() (stats ExecutorStats, err error) {
+	var computers Computers
+	if err = jenkins.get(context.Background(), "/computer", url.Values{"tree": []string{"busyExecutors,totalExecutors"}}, &computers); err != nil {
+		return
+	}
+	queueLength, err := jenkins.GetQueueLength()
+	if err != nil {
+		return
+	}
+
+	stats.TotalExecutors = computers.TotalExecutors
+	stats.BusyExecutors = computers.BusyExecutors
+	stats.QueueLength = queueLength
+	return
+}
+
+// GetComputer returns the node which has specified name.
+// The built-in node can be requested as "master" or "built-in" whatever the Jenkins version.
+func (jenkins *Jenkins) GetComputer(name string) (computer Computer, err error) {
+	err = withComputerPath(name, func(path string) error {
+		return jenkins.get(context.Background(), path, nil, &computer)
+	})
+	return
+}
+
+// GetComputerLabels returns the labels of the named node, including the one matching its own name.
+func (jenkins *Jenkins) GetComputerLabels(name string) ([]string, error) {
+	computer, err := jenkins.GetComputer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, 0, len(computer.AssignedLabels))
+	for _, label := range computer.AssignedLabels {
+		labels = append(labels, label.Name)
+	}
+	return labels, nil
+}
+
+// GetLabel returns the named label, or label expression, with the executors of the nodes matching it.
+func (jenkins *Jenkins) GetLabel(label string) (result Label, err error) {
+	err = jenkins.get(context.Background(), "/label/"+url.PathEscape(label), nil, &result)
+	return
+}
+
+// ToggleComputerOffline takes the named node temporarily offline with reason as its offline message,
+// or brings it back online if it already is temporarily offline.
+func (jenkins *Jenkins) ToggleComputerOffline(name, reason string) error {
+	params := url.Values{"offlineMessage": []string{reason}}
+	return withComputerPath(name, func(path string) error {
+		return jenkins.post(context.Background(), path+"/toggleOffline", params, nil)
+	})
+}
+
+// MarkComputerOffline takes the named node temporarily offline with reason as its offline message.
+// A node which already is temporarily offline just has its message replaced.
+func (jenkins *Jenkins) MarkComputerOffline(name, reason string) error {
+	computer, err := jenkins.GetComputer(name)
+	if err != nil {
+		return err
+	}
+
+	if computer.TemporarilyOffline {
+		params := url.Values{"offlineMessage": []string{reason}}
+		err = withComputerPath(name, func(path string) error {
+			return jenkins.post(context.Background(), path+"/changeOfflineCause", params, nil)
+		})
+	} else {
+		err = jenkins.ToggleComputerOffline(name, reason)
+	}
+	if err != nil {
+		return err
+	}
+	return jenkins.checkComputerOffline(name, true)
+}
+
+// MarkComputerOnline brings the named node back online if it is temporarily offline.
+func (jenkins *Jenkins) MarkComputerOnline(name string) error {
+	computer, err := jenkins.GetComputer(name)
+	if err != nil {
+		return err
+	}
+
+	if !computer.TemporarilyOffline {
+		return nil
+	}
+	if err = jenkins.ToggleComputerOffline(name, ""); err != nil {
+		return err
+	}
+	return jenkins.checkComputerOffline(name, false)
+}
+
+// checkComputerOffline fetches the named node again and returns an error unless its temporarily
+// offline state is offline.
+func (jenkins *Jenkins) checkComputerOffline(name string, offline bool) error {
+	computer, err := jenkins.GetComputer(name)
+	if err != nil {
+		return err
+	}
+	if computer.TemporarilyOffline != offline {
+		return fmt.Errorf("jenkins: computer %s did not change its temporarily offline state to %t", name, offline)
+	}
+	return nil
+}
+
+// GetComputerLog returns the agent log of the named node, which records how it connected
+// and disconnected.
+func (jenkins *Jenkins) GetComputerLog(name string) (log []byte, err error) {
+	err = withComputerPath(name, func(path string) error {
+		resp, err := jenkins.getRaw(context.Background(), jenkins.buildRawUrl(path+"/log", nil))
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+		log, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	return
+}
+
+// GetTestResults returns the test report of the number-th build of specified job.
+// It returns ErrNoTestResults when the build did not publish any.
+func (jenkins *Jenkins) GetTestResults(job Job, number int) (result TestResult, err error) {
+	err = jenkins.get(context.Background(), fmt.Sprintf("%s/%d/testReport", jobPath(job.Name), number), nil, &result)
+	if isStatus(err, http.StatusNotFound) {
+		err = ErrNoTestResults
+	}
+	return
+}
+
+// GetBuildChangeSet returns the commits the build picked up since the previous build,
+// across all the repositories it checked out.
+func (jenkins *Jenkins) GetBuildChangeSet(build Build) ([]ChangeSetItem, error) {
+	var fetched Build
+	if err := jenkins.getUrl(context.Background(), objectApiUrl(build.Url, nil), &fetched); err != nil {
+		return nil, err
+	}
+
+	items := fetched.ChangeSet.Items
+	for _, changeSet := range fetched.ChangeSets {
+		items = append(items, changeSet.Items...)
+	}
+	return items, nil
+}
+
+// GetPipelineStages returns the stages of the number-th build of specified pipeline job.
+// It returns ErrNotPipeline for other kinds of builds.
+func (jenkins *Jenkins) GetPipelineStages(job Job, number int) ([]Stage, error) {
+	var description struct {
+		Stages []Stage `json:"stages"`
+	}
+	err := jenkins.getUrl(context.Background(), jenkins.buildRawUrl(fmt.Sprintf("%s/%d/wfapi/describe", jobPath(job.Name), number), nil), &description)
+	if isStatus(err, http.StatusNotFound) {
+		err = ErrNotPipeline
+	}
+	return description.Stages, err
+}
+
+// replayScript matches the main script in the form of a build's replay page.
+var replayScript = regexp.MustCompile(`(?s)<textarea[^>]*name="_\.mainScript"[^>]*>(.*?)</textarea>`)
+
+// ReplayBuild runs the number-th build of specified pipeline job again, with the same parameters,
+// revision and pipeline script, and returns the number of the new build.
+// Jenkins does not tell which build the replay becomes, so this is the next build number of the job
+// just before the replay is scheduled; a build of the job triggered at the same time may take it.
+func (jenkins *Jenkins) ReplayBuild(job Job, number int) (int, error) {
+	ctx := context.Background()
+	path := fmt.Sprintf("%s/%d/replay", jobPath(job.Name), number)
+
+	// The replay page is only available as an HTML form which holds the script of the build.
+	res, err := jenkins.getRaw(ctx, jenkins.buildRawUrl(path, nil))
+	if err != nil {
+		return 0, err
+	}
+	page, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	match := replayScript.FindSubmatch(page)
+	if match == nil {
+		return 0, fmt.Errorf("jenkins: build %d of %s cannot be replayed", number, job.Name)
+	}
+	script := html.UnescapeString(string(match[1]))
+
+	config, err := json.Marshal(map[string]string{"mainScript": script})
+	if err != nil {
+		return 0, err
+	}
+
+	var next Job
+	if err = jenkins.get(ctx, jobPath(job.Name), url.Values{"tree": []string{"nextBuildNumber"}}, &next); err != nil {
+		return 0, err
+	}
+	form := url.Values{"mainScript": []string{script}, "json": []string{string(config)}}
+	if err = jenkins.postForm(ctx, path+"/run", form, nil); err != nil {
+		return 0, err
+	}
+	return next.NextBuildNumber, nil
+}
+
+// GetPipelineNodeLog returns the log of a single node, such as a step, of the number-th build of specified
+// pipeline job. nodeId is a Stage Id or the id of one of its steps.
+func (jenkins *Jenkins) GetPipelineNodeLog(job Job, number int, nodeId string) ([]byte, error) {
+	path := fmt.Sprintf("%s/%d/execution/node/%s/log", jobPath(job.Name), number, url.PathEscape(nodeId))
+	res, err := jenkins.getRaw(context.Background(), jenkins.buildRawUrl(path, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// GetBuildEnvVars returns the environment variables injected into the number-th build of
+// specified job by the EnvInject plugin. It returns ErrNoEnvVars when there are none.
+func (jenkins *Jenkins) GetBuildEnvVars(job Job, number int) (map[string]string, error) {
+	var envVars struct {
+		EnvMap map[string]string `json:"envMap"`
+	}
+	err := jenkins.get(context.Background(), fmt.Sprintf("%s/%d/injectedEnvVars", jobPath(job.Name), number), nil, &envVars)
+	if isStatus(err, http.StatusNotFound) {
+		err = ErrNoEnvVars
+	}
+	return envVars.EnvMap, err
+}
+
+// QuietDown stops Jenkins from starting new builds, e.g. ahead of a restart.
+// It requires the Administer permission.
+func (jenkins *Jenkins) QuietDown() error {
+	return jenkins.postAdmin("/quietDown")
+}
+
+// CancelQuietDown lets Jenkins start new builds again after QuietDown.
+// It requires the Administer permission.
+func (jenkins *Jenkins) CancelQuietDown() error {
+	return jenkins.postAdmin("/cancelQuietDown")
+}
+
+// SafeRestart restarts Jenkins once the running builds finish, starting no new builds meanwhile.
+// It requires the Administer permission.
+func (jenkins *Jenkins) SafeRestart() error {
+	return jenkins.postAdmin("/safeRestart")
+}
+
+// postAdmin posts to path, which requires the Administer permission.
+func (jenkins *Jenkins) postAdmin(path string) error {
+	err := jenkins.post(context.Background(), path, nil, nil)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("jenkins: %s requires the Administer permission: %w", path, err)
+	}
+	return err
+}
+
+// GetSystemConfigXML returns the config.xml of Jenkins itself, for backups.
+// It requires the Administer permission; the error then matches ErrPermissionDenied.
+func (jenkins *Jenkins) GetSystemConfigXML() ([]byte, error) {
+	res, err := jenkins.getRaw(context.Background(), jenkins.buildRawUrl("/config.xml", nil))
+	if errors.Is(err, ErrPermissionDenied) {
+		return nil, fmt.Errorf("jenkins: /config.xml requires the Administer permission: %w", err)
+	}
+	if err != nil {
 		return nil, err
 	}
 
 	defer res.Body.Close()
 	return ioutil.ReadAll(res.Body)
 }
+
+// UpdateSystemConfigXML replaces the config.xml of Jenkins itself, e.g. to restore a backup.
+// It requires the Administer permission; the error then matches ErrPermissionDenied.
+func (jenkins *Jenkins) UpdateSystemConfigXML(config io.Reader) error {
+	err := jenkins.postXml(context.Background(), "/config.xml", nil, config, nil)
+	if errors.Is(err, ErrPermissionDenied) {
+		return fmt.Errorf("jenkins: /config.xml requires the Administer permission: %w", err)
+	}
+	return err
+}
+
+// RunScript runs a Groovy script in the script console and returns what it printed.
+//
+// The script runs inside the Jenkins controller with full access to it, its secrets and the
+// machine it runs on, which is why the Administer permission is required; the error then matches
+// ErrPermissionDenied. Never pass it scripts built from untrusted input.
+func (jenkins *Jenkins) RunScript(groovy string) (string, error) {
+	form := url.Values{"script": []string{groovy}}
+	resp, err := jenkins.request(context.Background(), "POST", jenkins.buildRawUrl("/scriptText", nil), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if errors.Is(err, ErrPermissionDenied) {
+		return "", fmt.Errorf("jenkins: /scriptText requires the Administer permission: %w", err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	output, err := ioutil.ReadAll(resp.Body)
+	return string(output), err
+}
+
+// InstallPlugin asks Jenkins to install a plugin by its short name, at version or, when version is
+// empty, at the latest version. It returns once the request is accepted; the installation itself
+// can be followed with GetUpdateCenterStatus.
+func (jenkins *Jenkins) InstallPlugin(shortName, version string) error {
+	if version == "" {
+		version = "latest"
+	}
+	installXml, err := xml.Marshal(pluginInstallRequest{Install: []pluginInstall{{Plugin: shortName + "@" + version}}})
+	if err != nil {
+		return err
+	}
+	return jenkins.postXml(context.Background(), "/pluginManager/installNecessaryPlugins", nil, bytes.NewReader(installXml), nil)
+}
+
+// GetUpdateCenterStatus returns the tasks of the update center, e.g. to follow plugin installations.
+func (jenkins *Jenkins) GetUpdateCenterStatus() (status UpdateCenterStatus, err error) {
+	params := url.Values{"depth": []string{"1"}}
+	err = jenkins.get(context.Background(), "/updateCenter", params, &status)
+	return
+}
+
+// GetArtifact return the content of a build artifact
+func (jenkins *Jenkins) GetArtifact(build Build, artifact Artifact) ([]byte, error) {
+	var content bytes.Buffer
+	if _, err := jenkins.DownloadArtifact(build, artifact, &content); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+// DownloadArtifact copies the content of a build artifact to w and returns the number of bytes written.
+func (jenkins *Jenkins) DownloadArtifact(build Build, artifact Artifact, w io.Writer) (int64, error) {
+	requestUrl := fmt.Sprintf("%s/artifact/%s", build.Url, artifact.RelativePath)
+	res, err := jenkins.getRaw(context.Background(), requestUrl)
+	if isStatus(err, http.StatusNotFound) {
+		return 0, fmt.Errorf("jenkins: artifact %s not found: %w", artifact.RelativePath, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	return io.Copy(w, res.Body)
+}
+
+// GetAllArtifactsZip copies all artifacts of a build, zipped, to w and returns the number of bytes written.
+func (jenkins *Jenkins) GetAllArtifactsZip(build Build, w io.Writer) (int64, error) {
+	requestUrl := fmt.Sprintf("%s/artifact/*zip*/archive.zip", build.Url)
+	res, err := jenkins.getRaw(context.Background(), requestUrl)
+	if isStatus(err, http.StatusNotFound) {
+		return 0, fmt.Errorf("jenkins: build %s has no artifacts: %w", build.Url, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	return io.Copy(w, res.Body)
+}
@@ -1,7 +1,21 @@
 package gojenkins
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -11,6 +25,12 @@ func NewJenkinsWithTestData() *Jenkins {
 	return NewJenkins(&auth, "http://example.com")
 }
 
+// newTestJenkins returns a Jenkins talking to a test server which serves handler.
+func newTestJenkins(handler http.Handler) (*Jenkins, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	return NewJenkins(&Auth{}, server.URL), server
+}
+
 func Test(t *testing.T) {
 	jenkins := NewJenkinsWithTestData()
 	jobs, err := jenkins.GetJobs()
@@ -112,3 +132,2950 @@ func TestCreateJobItem(t *testing.T) {
 		t.Errorf("error %s not found\n", newJobName)
 	}
 }
+
+type countingTransport struct {
+	requests int
+}
+
+func (transport *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewJenkinsWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jobs": [{"name": "test"}]}`)
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	jenkins := NewJenkinsWithClient(&Auth{}, server.URL, &http.Client{Transport: transport})
+	jobs, err := jenkins.GetJobs()
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if len(jobs) != 1 {
+		t.Errorf("return %d jobs, expected 1\n", len(jobs))
+	}
+
+	if transport.requests != 1 {
+		t.Errorf("custom client used %d times, expected 1\n", transport.requests)
+	}
+}
+
+func TestGetJobContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkins(&Auth{}, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := jenkins.GetJobContext(ctx, "test")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, expected context deadline exceeded\n", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, expected prompt return\n", elapsed)
+	}
+}
+
+func TestGetJobNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>Not Found</html>", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkins(&Auth{}, server.URL)
+	_, err := jenkins.GetJob("missing")
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("error %v, expected *HTTPError\n", err)
+	}
+
+	if httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("status code %d, expected %d\n", httpErr.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestCrumbAttachedToPost(t *testing.T) {
+	var crumb string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/crumbIssuer/api/json":
+			fmt.Fprint(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "abc123"}`)
+		case "/createView":
+			crumb = r.Header.Get("Jenkins-Crumb")
+		}
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkins(&Auth{}, server.URL)
+	err := jenkins.CreateView(NewListView("test"))
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if crumb != "abc123" {
+		t.Errorf("Jenkins-Crumb header %q, expected %q\n", crumb, "abc123")
+	}
+}
+
+func TestCrumbIssuerDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/json" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkins(&Auth{}, server.URL)
+	err := jenkins.CreateView(NewListView("test"))
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+}
+
+func TestDeleteJob(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/crumbIssuer/api/json":
+			http.NotFound(w, r)
+		case "/job/test/doDelete":
+			method, path = r.Method, r.URL.Path
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	jenkins := NewJenkins(&Auth{}, server.URL)
+	err := jenkins.DeleteJob("test")
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if method != "POST" || path != "/job/test/doDelete" {
+		t.Errorf("request %s %s, expected POST /job/test/doDelete\n", method, path)
+	}
+
+	if err := jenkins.DeleteJob("missing"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestStopBuild(t *testing.T) {
+	var paths []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/7/", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.StopBuild(Job{Name: "test"}, 7); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.KillBuild(Job{Name: "test"}, 7); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := []string{"POST /job/test/7/stop", "POST /job/test/7/kill"}
+	if fmt.Sprint(paths) != fmt.Sprint(expected) {
+		t.Errorf("requests %v, expected %v\n", paths, expected)
+	}
+}
+
+func TestCancelQueueItem(t *testing.T) {
+	var id string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/cancelItem", func(w http.ResponseWriter, r *http.Request) {
+		id = r.URL.Query().Get("id")
+		http.NotFound(w, r)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	err := jenkins.CancelQueueItem(42)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if id != "42" {
+		t.Errorf("cancelled item %q, expected %q\n", id, "42")
+	}
+}
+
+func TestGetQueueItemUrl(t *testing.T) {
+	var path string
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		fmt.Fprint(w, `{"id": 42}`)
+	}))
+	defer server.Close()
+
+	item, err := jenkins.GetQueueItem(42)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if path != "/queue/item/42/api/json" {
+		t.Errorf("requested %s, expected /queue/item/42/api/json\n", path)
+	}
+
+	if item.Id != 42 {
+		t.Errorf("item id %d, expected 42\n", item.Id)
+	}
+}
+
+func TestWaitForBuildFromQueue(t *testing.T) {
+	var server *httptest.Server
+	var polls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/item/5/api/json", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 2 {
+			fmt.Fprint(w, `{"id": 5, "why": "Waiting for next available executor"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": 5, "executable": {"number": 3, "url": "%s/job/test/3/"}}`, server.URL)
+	})
+	mux.HandleFunc("/queue/item/6/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 6, "cancelled": true}`)
+	})
+	mux.HandleFunc("/job/test/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 3, "building": true}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build, err := jenkins.WaitForBuildFromQueue(Item{Id: 5}, time.Millisecond, time.Second)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if build.Number != 3 {
+		t.Errorf("build number %d, expected 3\n", build.Number)
+	}
+
+	_, err = jenkins.WaitForBuildFromQueue(Item{Id: 6}, time.Millisecond, time.Second)
+
+	if err != ErrQueueItemCancelled {
+		t.Errorf("error %v, expected %v\n", err, ErrQueueItemCancelled)
+	}
+}
+
+func TestStreamConsole(t *testing.T) {
+	log := "Started\nBuilding\nFinished: SUCCESS\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/logText/progressiveText", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		end := strings.Index(log[start:], "\n") + start + 1
+		w.Header().Set("X-Text-Size", strconv.Itoa(end))
+		if end < len(log) {
+			w.Header().Set("X-More-Data", "true")
+		}
+		fmt.Fprint(w, log[start:end])
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jenkins.ConsolePollInterval = time.Millisecond
+	var output bytes.Buffer
+	err := jenkins.StreamConsole(Build{Url: server.URL + "/job/test/1"}, &output)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if output.String() != log {
+		t.Errorf("streamed %q, expected %q\n", output.String(), log)
+	}
+}
+
+func TestGetBuildConsoleOutputStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/consoleText", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Finished: SUCCESS\n")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	stream, err := jenkins.GetBuildConsoleOutputStream(Build{Url: server.URL + "/job/test/1"})
+	if err != nil {
+		t.Fatalf("error %v\n", err)
+	}
+	defer stream.Close()
+
+	output, _ := ioutil.ReadAll(stream)
+	if string(output) != "Finished: SUCCESS\n" {
+		t.Errorf("console output %q\n", output)
+	}
+
+	_, err = jenkins.GetBuildConsoleOutputStream(Build{Url: server.URL + "/job/missing/1"})
+	if !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/artifact/target/app.jar", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "jar content")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build := Build{Url: server.URL + "/job/test/1"}
+	var content bytes.Buffer
+	written, err := jenkins.DownloadArtifact(build, Artifact{RelativePath: "target/app.jar"}, &content)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if written != int64(len("jar content")) || content.String() != "jar content" {
+		t.Errorf("downloaded %d bytes %q\n", written, content.String())
+	}
+
+	_, err = jenkins.GetArtifact(build, Artifact{RelativePath: "missing.jar"})
+	if !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestGetAllArtifactsZip(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/artifact/*zip*/archive.zip", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "zip content")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	var content bytes.Buffer
+	written, err := jenkins.GetAllArtifactsZip(Build{Url: server.URL + "/job/test/1"}, &content)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if written != int64(len("zip content")) || content.String() != "zip content" {
+		t.Errorf("downloaded %d bytes %q\n", written, content.String())
+	}
+
+	_, err = jenkins.GetAllArtifactsZip(Build{Url: server.URL + "/job/test/2"}, &content)
+	var httpErr *HTTPError
+	if err == nil || !strings.Contains(err.Error(), "has no artifacts") || !errors.As(err, &httpErr) || !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a wrapped 404\n", err)
+	}
+}
+
+func TestGetBuildArtifacts(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"artifacts": [{"displayPath": "app.jar", "fileName": "app.jar", "relativePath": "target/app.jar"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	artifacts, err := jenkins.GetBuildArtifacts(Build{Url: server.URL + "/job/test/1/"})
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if len(artifacts) != 1 || artifacts[0].RelativePath != "target/app.jar" {
+		t.Errorf("artifacts %+v\n", artifacts)
+	}
+}
+
+func TestGetLastBuild(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/lastBuild/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 12, "result": "SUCCESS"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build, err := jenkins.GetLastBuild(Job{Name: "test"})
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if build.Number != 12 {
+		t.Errorf("build number %d, expected 12\n", build.Number)
+	}
+
+	if _, err := jenkins.GetLastFailedBuild(Job{Name: "test"}); err != ErrNoBuilds {
+		t.Errorf("error %v, expected %v\n", err, ErrNoBuilds)
+	}
+}
+
+func TestGetJobBuilds(t *testing.T) {
+	var tree string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/api/json", func(w http.ResponseWriter, r *http.Request) {
+		tree = r.URL.Query().Get("tree")
+		fmt.Fprint(w, `{"builds": [{"number": 2, "result": "FAILURE"}, {"number": 1, "result": "SUCCESS"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	builds, err := jenkins.GetJobBuilds(Job{Name: "test"}, 2)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if tree != "builds[number,result,timestamp,duration,url]{0,2}" {
+		t.Errorf("tree %q\n", tree)
+	}
+
+	if len(builds) != 2 || builds[0].Result != "FAILURE" {
+		t.Errorf("builds %+v\n", builds)
+	}
+}
+
+func TestGetJobsRange(t *testing.T) {
+	var tree string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		tree = r.URL.Query().Get("tree")
+		fmt.Fprint(w, `{"jobs": [{"name": "deploy", "color": "blue"}, {"name": "test", "color": "red"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jobs, err := jenkins.GetJobsRange(10, 12)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if tree != "jobs[name,url,color]{10,12}" {
+		t.Errorf("tree %q\n", tree)
+	}
+
+	if len(jobs) != 2 || jobs[0].Name != "deploy" || jobs[1].Color != "red" {
+		t.Errorf("jobs %+v\n", jobs)
+	}
+}
+
+func TestBuildUrlWithTree(t *testing.T) {
+	jenkins := NewJenkinsWithTestData()
+	requestUrl := jenkins.buildUrl("/job/test", url.Values{"tree": []string{"name,color"}})
+
+	if requestUrl != "http://example.com/job/test/api/json?tree=name%2Ccolor" {
+		t.Errorf("url %s\n", requestUrl)
+	}
+}
+
+func TestGetJobsRecursive(t *testing.T) {
+	var server *httptest.Server
+	folder := "com.cloudbees.hudson.plugins.folder.Folder"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jobs": [{"name": "top"}, {"_class": "%s", "name": "a", "url": "%s/job/a/"}]}`, folder, server.URL)
+	})
+	mux.HandleFunc("/job/a/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jobs": [{"_class": "%s", "name": "b", "url": "%s/job/a/job/b/"}]}`, folder, server.URL)
+	})
+	mux.HandleFunc("/job/a/job/b/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jobs": [{"name": "deploy"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jobs, err := jenkins.GetJobsRecursive()
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	var names []string
+	for _, job := range jobs {
+		names = append(names, job.Name)
+	}
+	if fmt.Sprint(names) != "[top a/b/deploy]" {
+		t.Errorf("jobs %v, expected [top a/b/deploy]\n", names)
+	}
+}
+
+func TestJobPath(t *testing.T) {
+	var paths = map[string]string{
+		"deploy":           "/job/deploy",
+		"team/deploy":      "/job/team/job/deploy",
+		"org/team/deploy/": "/job/org/job/team/job/deploy",
+	}
+	for name, expected := range paths {
+		if path := jobPath(name); path != expected {
+			t.Errorf("jobPath(%q) = %q, expected %q\n", name, path, expected)
+		}
+	}
+}
+
+func TestCopyJob(t *testing.T) {
+	var query url.Values
+	var contentType string
+	var body []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/createItem", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	err := jenkins.CopyJob("template", "new-job")
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if query.Get("name") != "new-job" || query.Get("mode") != "copy" || query.Get("from") != "/template" {
+		t.Errorf("query %v\n", query)
+	}
+
+	if contentType != "" || len(body) != 0 {
+		t.Errorf("content type %q and body %q, expected none\n", contentType, body)
+	}
+}
+
+func TestCopyJobIntoFolder(t *testing.T) {
+	var query url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/team/job/services/createItem", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.CopyJob("templates/deploy", "team/services/deploy-api"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if query.Get("name") != "deploy-api" || query.Get("mode") != "copy" || query.Get("from") != "/templates/deploy" {
+		t.Errorf("query %v\n", query)
+	}
+}
+
+func TestRenameJob(t *testing.T) {
+	var method, newName string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/a/job/b/doRename", func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		newName = r.URL.Query().Get("newName")
+		if newName == "taken" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.RenameJob("a/b", "c"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if method != "POST" || newName != "c" {
+		t.Errorf("method %s and new name %q\n", method, newName)
+	}
+
+	err := jenkins.RenameJob("a/b", "taken")
+	var httpErr *HTTPError
+	if err == nil || !strings.Contains(err.Error(), "new name may already be taken") || !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("error %v, expected a wrapped 400\n", err)
+	}
+}
+
+func TestCreateJobWithXML(t *testing.T) {
+	var name, config string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/createItem", func(w http.ResponseWriter, r *http.Request) {
+		name = r.URL.Query().Get("name")
+		body, _ := ioutil.ReadAll(r.Body)
+		config = string(body)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	err := jenkins.CreateJobWithXML("freestyle", strings.NewReader("<project/>"))
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if name != "freestyle" || config != "<project/>" {
+		t.Errorf("created %q with %q\n", name, config)
+	}
+}
+
+func TestPipelineJobItemXml(t *testing.T) {
+	inline := PipelineJobItem{Definition: NewInlinePipelineDefinition("node { echo 'hi' }", true)}
+	data, err := xml.Marshal(inline)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := `<definition class="org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"><script>node { echo &#39;hi&#39; }</script><sandbox>true</sandbox></definition>`
+	if !strings.HasPrefix(string(data), "<flow-definition>") || !strings.Contains(string(data), expected) {
+		t.Errorf("marshalled %s\n", data)
+	}
+
+	scm := Scm{
+		ScmContent: ScmGit{Branches: Branches{[]BranchesSpec{BranchesSpec{Name: "*/main"}}}},
+		Class:      "hudson.plugins.git.GitSCM",
+	}
+	fromScm := PipelineJobItem{Definition: NewScmPipelineDefinition(scm, "Jenkinsfile")}
+	data, _ = xml.Marshal(fromScm)
+
+	var parsed PipelineJobItem
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	git, ok := parsed.Definition.Scm.ScmContent.(*ScmGit)
+	if !ok || git.Branches.BranchesSpec[0].Name != "*/main" || parsed.Definition.ScriptPath != "Jenkinsfile" {
+		t.Errorf("unmarshalled %+v from %s\n", parsed.Definition, data)
+	}
+}
+
+func TestGetBuildParameters(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"actions": [{"_class": "hudson.model.ParametersAction", "parameters": [
+			{"_class": "hudson.model.StringParameterValue", "name": "BRANCH", "value": "main"},
+			{"_class": "hudson.model.BooleanParameterValue", "name": "DEPLOY", "value": true},
+			{"_class": "hudson.model.PasswordParameterValue", "name": "SECRET"}
+		]}, {}, {"_class": "hudson.model.CauseAction", "causes": []}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	params, err := jenkins.GetBuildParameters(Build{Url: server.URL + "/job/test/1/"})
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := url.Values{"BRANCH": []string{"main"}, "DEPLOY": []string{"true"}, "SECRET": []string{""}}
+	if params.Encode() != expected.Encode() {
+		t.Errorf("parameters %v, expected %v\n", params, expected)
+	}
+}
+
+func TestBuildReturnsQueueItem(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/build", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", server.URL+"/queue/item/9/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/queue/item/9/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 9, "why": "In the quiet period"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	item, err := jenkins.Build(Job{Name: "test"}, nil)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if item.Id != 9 {
+		t.Errorf("item id %d, expected 9\n", item.Id)
+	}
+}
+
+func TestQueueItemNumber(t *testing.T) {
+	var locations = map[string]int{
+		"http://example.com/queue/item/42/":         42,
+		"http://example.com/jenkins/queue/item/7/":  7,
+		"https://example.com:8443/ci/queue/item/13": 13,
+	}
+	for location, expected := range locations {
+		itemNo, err := queueItemNumber(location)
+		if err != nil || itemNo != expected {
+			t.Errorf("queueItemNumber(%q) = %d, %v, expected %d\n", location, itemNo, err, expected)
+		}
+	}
+
+	if _, err := queueItemNumber("http://example.com/job/test/"); err == nil {
+		t.Errorf("expected an error for a location which is not a queue item\n")
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	var auths = map[string]*Auth{
+		"Basic dXNlcjp0b2tlbg==": &Auth{Username: "user", ApiToken: "token"},
+		"Bearer secret":          &Auth{Username: "user", ApiToken: "token", BearerToken: "secret"},
+		"":                       nil,
+	}
+	for expected, auth := range auths {
+		if _, err := NewJenkins(auth, server.URL).GetJobs(); err != nil {
+			t.Errorf("error %v\n", err)
+		}
+		if authorization != expected {
+			t.Errorf("Authorization header %q, expected %q\n", authorization, expected)
+		}
+	}
+
+	if _, err := NewJenkins(&Auth{}, server.URL).GetJobs(); err != nil || authorization != "" {
+		t.Errorf("Authorization header %q with empty credentials, expected none\n", authorization)
+	}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	var gets, posts int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		if gets <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"jobs": [{"name": "test"}]}`)
+	})
+	mux.HandleFunc("/createView", func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jenkins.MaxRetries = 3
+	jenkins.RetryBackoff = time.Millisecond
+	jobs, err := jenkins.GetJobs()
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if len(jobs) != 1 || gets != 3 {
+		t.Errorf("got %d jobs after %d requests, expected 1 job after 3 requests\n", len(jobs), gets)
+	}
+
+	err = jenkins.CreateView(NewListView("test"))
+
+	if !isStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("error %v, expected 503\n", err)
+	}
+
+	if posts != 1 {
+		t.Errorf("sent %d POST requests, expected 1\n", posts)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Jenkins", "2.401.1")
+		w.Header().Set("X-Jenkins-Session", "a1b2c3")
+		fmt.Fprint(w, `{}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	version, err := jenkins.GetVersion()
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if version != "2.401.1" {
+		t.Errorf("version %q, expected %q\n", version, "2.401.1")
+	}
+
+	if info, _ := jenkins.GetServerInfo(); info.Session != "a1b2c3" {
+		t.Errorf("session %q, expected %q\n", info.Session, "a1b2c3")
+	}
+}
+
+func TestGetComputer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"computer": [{"displayName": "master", "numExecutors": 2}, {"displayName": "agent 1", "offline": true}]}`)
+	})
+	mux.HandleFunc("/computer/(master)/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"displayName": "master", "idle": true, "numExecutors": 2}`)
+	})
+	var agentPath string
+	mux.HandleFunc("/computer/", func(w http.ResponseWriter, r *http.Request) {
+		agentPath = r.URL.EscapedPath()
+		if agentPath != "/computer/agent%201/api/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"displayName": "agent 1", "offline": true}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	computers, err := jenkins.GetComputers()
+
+	if err != nil || len(computers) != 2 {
+		t.Errorf("computers %+v, error %v\n", computers, err)
+	}
+
+	master, err := jenkins.GetComputer("built-in")
+
+	if err != nil || master.NumExecutors != 2 {
+		t.Errorf("built-in computer %+v, error %v\n", master, err)
+	}
+
+	agent, err := jenkins.GetComputer("agent 1")
+
+	if err != nil || !agent.Offline {
+		t.Errorf("agent computer %+v, error %v\n", agent, err)
+	}
+	if agentPath != "/computer/agent%201/api/json" {
+		t.Errorf("requested %s, expected the escaped node name\n", agentPath)
+	}
+}
+
+func TestMarkComputerOffline(t *testing.T) {
+	var offline bool
+	var reason string
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computer/agent1/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computer/agent1/api/json":
+			fmt.Fprintf(w, `{"displayName": "agent1", "temporarilyOffline": %t, "offlineCauseReason": %q}`, offline, reason)
+			return
+		case "/computer/agent1/toggleOffline":
+			offline = !offline
+		}
+		reason = r.URL.Query().Get("offlineMessage")
+		requests = append(requests, r.URL.Path)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.MarkComputerOffline("agent1", "maintenance"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.MarkComputerOffline("agent1", "disk upgrade"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !offline || reason != "disk upgrade" {
+		t.Errorf("offline %t with reason %q, expected offline with reason %q\n", offline, reason, "disk upgrade")
+	}
+
+	if err := jenkins.MarkComputerOnline("agent1"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.MarkComputerOnline("agent1"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := []string{"/computer/agent1/toggleOffline", "/computer/agent1/changeOfflineCause", "/computer/agent1/toggleOffline"}
+	if offline || fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Errorf("offline %t after requests %v, expected online after %v\n", offline, requests, expected)
+	}
+}
+
+func TestGetView(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/release/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "release", "description": "Release jobs", "jobs": [{"name": "deploy"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	view, err := jenkins.GetView("release")
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if view.Description != "Release jobs" || len(view.Jobs) != 1 || view.Jobs[0].Name != "deploy" {
+		t.Errorf("view %+v\n", view)
+	}
+}
+
+func TestRemoveJobFromView(t *testing.T) {
+	var removed string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/release/removeJobFromView", func(w http.ResponseWriter, r *http.Request) {
+		removed = r.URL.Query().Get("name")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	err := jenkins.RemoveJobFromView("release", Job{Name: "deploy"})
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if removed != "deploy" {
+		t.Errorf("removed %q, expected %q\n", removed, "deploy")
+	}
+
+	if err := jenkins.RemoveJobFromView("missing", Job{Name: "deploy"}); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestRequestHook(t *testing.T) {
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	var logged []string
+	jenkins.auth = &Auth{Username: "user", ApiToken: "token"}
+	jenkins.RequestHook = func(req *http.Request, resp *http.Response, err error) {
+		logged = append(logged, fmt.Sprintf("%s %s %d %s", req.Method, req.URL.Path, resp.StatusCode, req.Header.Get("Authorization")))
+	}
+	if _, err := jenkins.GetJobs(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if fmt.Sprint(logged) != "[GET /api/json 200 REDACTED]" {
+		t.Errorf("logged %v\n", logged)
+	}
+}
+
+func TestGetTestResults(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/3/testReport/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"failCount": 1, "passCount": 1, "skipCount": 0, "suites": [{"name": "unit", "cases": [
+			{"name": "TestA", "status": "PASSED", "duration": 0.1},
+			{"name": "TestB", "status": "FAILED", "errorStackTrace": "boom"}
+		]}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	result, err := jenkins.GetTestResults(Job{Name: "test"}, 3)
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if result.FailCount != 1 || len(result.Suites) != 1 || result.Suites[0].Cases[1].ErrorStackTrace != "boom" {
+		t.Errorf("test results %+v\n", result)
+	}
+
+	if _, err := jenkins.GetTestResults(Job{Name: "test"}, 4); err != ErrNoTestResults {
+		t.Errorf("error %v, expected %v\n", err, ErrNoTestResults)
+	}
+}
+
+func TestWaitForBuild(t *testing.T) {
+	var polls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 3 {
+			fmt.Fprint(w, `{"number": 3, "building": true}`)
+			return
+		}
+		fmt.Fprint(w, `{"number": 3, "building": false, "result": "SUCCESS"}`)
+	})
+	mux.HandleFunc("/job/test/4/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 4, "building": true}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build, err := jenkins.WaitForBuild(Job{Name: "test"}, 3, time.Millisecond, time.Second)
+
+	if err != nil || build.Result != "SUCCESS" {
+		t.Errorf("build %+v, error %v\n", build, err)
+	}
+
+	build, err = jenkins.WaitForBuild(Job{Name: "test"}, 4, time.Millisecond, 10*time.Millisecond)
+
+	if err != ErrTimeout || build.Number != 4 {
+		t.Errorf("build %+v, error %v, expected the running build and %v\n", build, err, ErrTimeout)
+	}
+}
+
+func TestBuildHelpers(t *testing.T) {
+	build := Build{Timestamp: 1500000000123, Result: "SUCCESS"}
+
+	if !build.IsSuccess() {
+		t.Errorf("build %+v is not a success\n", build)
+	}
+
+	if start := build.StartTime(); !start.Equal(time.Date(2017, 7, 14, 2, 40, 0, 123000000, time.UTC)) {
+		t.Errorf("start time %v\n", start)
+	}
+}
+
+func TestGetJobConfigXML(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<project><description>test</description></project>`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	config, err := jenkins.GetJobConfigXML("test")
+
+	if err != nil || string(config) != `<project><description>test</description></project>` {
+		t.Errorf("config %s, error %v\n", config, err)
+	}
+
+	if _, err := jenkins.GetJobConfigXML("missing"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestAdministrativeMethods(t *testing.T) {
+	var paths []string
+	mux := http.NewServeMux()
+	for _, path := range []string{"/quietDown", "/cancelQuietDown"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.Method+" "+r.URL.Path)
+		})
+	}
+	mux.HandleFunc("/safeRestart", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.QuietDown(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.CancelQuietDown(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if fmt.Sprint(paths) != "[POST /quietDown POST /cancelQuietDown]" {
+		t.Errorf("requests %v\n", paths)
+	}
+
+	if err := jenkins.SafeRestart(); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, expected %v\n", err, ErrPermissionDenied)
+	}
+}
+
+func TestTriggerAndWait(t *testing.T) {
+	var server *httptest.Server
+	var polls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/buildWithParameters", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", server.URL+"/queue/item/5/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/job/disabled/build", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	mux.HandleFunc("/queue/item/5/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": 5, "executable": {"number": 3, "url": "%s/job/test/3/"}}`, server.URL)
+	})
+	mux.HandleFunc("/job/test/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		fmt.Fprintf(w, `{"number": 3, "building": %t, "result": "FAILURE"}`, polls < 3)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build, err := jenkins.TriggerAndWait(Job{Name: "test"}, url.Values{"BRANCH": []string{"main"}}, time.Millisecond, time.Second)
+
+	if err != nil || build.Building || build.Result != "FAILURE" {
+		t.Errorf("build %+v, error %v\n", build, err)
+	}
+
+	if _, err := jenkins.TriggerAndWait(Job{Name: "disabled"}, nil, time.Millisecond, time.Second); err != ErrJobDisabled {
+		t.Errorf("error %v, expected %v\n", err, ErrJobDisabled)
+	}
+}
+
+func TestGetJobParameters(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"property": [{}, {"parameterDefinitions": [
+			{"name": "BRANCH", "type": "StringParameterDefinition", "defaultParameterValue": {"name": "BRANCH", "value": "main"}},
+			{"name": "ENV", "type": "ChoiceParameterDefinition", "choices": ["staging", "production"]}
+		]}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	definitions, err := jenkins.GetJobParameters("test")
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if len(definitions) != 2 || definitions[0].DefaultParameterValue.Value != "main" || len(definitions[1].Choices) != 2 {
+		t.Errorf("parameter definitions %+v\n", definitions)
+	}
+}
+
+func TestBuildValidated(t *testing.T) {
+	var built bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"property": [{"parameterDefinitions": [
+			{"name": "BRANCH", "defaultParameterValue": {"name": "BRANCH", "value": "main"}},
+			{"name": "VERSION"}
+		]}]}`)
+	})
+	mux.HandleFunc("/job/test/buildWithParameters", func(w http.ResponseWriter, r *http.Request) {
+		built = true
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	_, err := jenkins.BuildValidated(Job{Name: "test"}, url.Values{"BRANHC": []string{"dev"}})
+
+	if err == nil || err.Error() != "jenkins: invalid parameters for test: unknown [BRANHC], missing [VERSION]" || built {
+		t.Errorf("error %v, built %t\n", err, built)
+	}
+
+	if _, err := jenkins.BuildValidated(Job{Name: "test"}, url.Values{"VERSION": []string{"1.0"}}); err != nil || !built {
+		t.Errorf("error %v, built %t\n", err, built)
+	}
+}
+
+func TestGetQueueForJob(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"items": [
+			{"id": 1, "blocked": true, "task": {"name": "deploy", "url": "%[1]s/job/deploy/"}},
+			{"id": 2, "buildable": true, "task": {"name": "build", "url": "%[1]s/job/build/"}},
+			{"id": 3, "stuck": true, "task": {"name": "deploy", "url": "%[1]s/job/team/job/deploy/"}}
+		]}`, server.URL)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	items, err := jenkins.GetQueueForJob(Job{Name: "deploy"})
+
+	if err != nil || len(items) != 1 || items[0].Id != 1 || !items[0].Blocked {
+		t.Errorf("items %+v, error %v\n", items, err)
+	}
+
+	items, err = jenkins.GetQueueForJob(Job{Name: "team/deploy"})
+
+	if err != nil || len(items) != 1 || items[0].Id != 3 || !items[0].Stuck {
+		t.Errorf("items %+v, error %v\n", items, err)
+	}
+
+	items, err = jenkins.GetQueueForJob(Job{Name: "deploy", Url: server.URL + "/job/team/job/deploy/"})
+
+	if err != nil || len(items) != 1 || items[0].Id != 3 {
+		t.Errorf("items %+v, error %v\n", items, err)
+	}
+}
+
+func TestItemWaitDuration(t *testing.T) {
+	item := Item{InQueueSince: time.Now().Add(-time.Minute).UnixNano() / int64(time.Millisecond)}
+
+	if wait := item.WaitDuration(); wait < time.Minute || wait > time.Minute+time.Second {
+		t.Errorf("wait duration %v, expected a minute\n", wait)
+	}
+}
+
+func TestDo(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/plugin/custom/api/json", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"method": %q, "query": %q, "body": %q}`, r.Method, r.URL.RawQuery, body)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	var payload = struct {
+		Method string `json:"method"`
+		Query  string `json:"query"`
+		Body   string `json:"body"`
+	}{}
+	err := jenkins.Do("PUT", "/plugin/custom/api/json", url.Values{"a": []string{"b"}}, strings.NewReader("data"), &payload)
+
+	if err != nil || payload.Method != "PUT" || payload.Query != "a=b" || payload.Body != "data" {
+		t.Errorf("payload %+v, error %v\n", payload, err)
+	}
+
+	if err := jenkins.Do("GET", "/missing", nil, nil, nil); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected 404\n", err)
+	}
+}
+
+func TestInstallPlugin(t *testing.T) {
+	var install string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pluginManager/installNecessaryPlugins", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		install = string(body)
+	})
+	mux.HandleFunc("/updateCenter/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jobs": [{"id": 1, "type": "InstallationJob", "name": "git", "status": {"type": "Installing"}}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.InstallPlugin("git", "4.0"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if install != `<jenkins><install plugin="git@4.0"></install></jenkins>` {
+		t.Errorf("install request %s\n", install)
+	}
+
+	status, err := jenkins.GetUpdateCenterStatus()
+
+	if err != nil || len(status.Jobs) != 1 || status.Jobs[0].Status.Type != "Installing" {
+		t.Errorf("status %+v, error %v\n", status, err)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	anonymous := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/whoAmI/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if anonymous {
+			fmt.Fprint(w, `{"name": "anonymous", "anonymous": true, "authenticated": true, "authorities": ["anonymous"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"name": "alice", "anonymous": false, "authenticated": true, "authorities": ["authenticated"]}`)
+	})
+	mux.HandleFunc("/me/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "alice", "fullName": "Alice Smith"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	user, err := jenkins.WhoAmI()
+
+	if err != nil || user.Id != "anonymous" || !user.Anonymous {
+		t.Errorf("user %+v, error %v\n", user, err)
+	}
+
+	anonymous = false
+	user, err = jenkins.WhoAmI()
+
+	if err != nil || user.Id != "alice" || user.FullName != "Alice Smith" || user.Anonymous {
+		t.Errorf("user %+v, error %v\n", user, err)
+	}
+}
+
+func TestJobDescription(t *testing.T) {
+	var description string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/description", func(w http.ResponseWriter, r *http.Request) {
+		description = r.PostFormValue("description")
+	})
+	mux.HandleFunc("/job/test/api/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"description": description})
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	expected := "Owner: team-a & team-b\nRunbook: https://wiki.example.com/runbook?job=test"
+	if err := jenkins.SetJobDescription("test", expected); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	actual, err := jenkins.GetJobDescription("test")
+
+	if err != nil || actual != expected {
+		t.Errorf("description %q, error %v, expected %q\n", actual, err, expected)
+	}
+}
+
+func TestSetBuildDisplayName(t *testing.T) {
+	var config map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 3, "description": "deployed to staging"}`)
+	})
+	mux.HandleFunc("/job/test/3/configSubmit", func(w http.ResponseWriter, r *http.Request) {
+		json.Unmarshal([]byte(r.PostFormValue("json")), &config)
+		http.Redirect(w, r, "/job/test/3/api/json", http.StatusFound)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	err := jenkins.SetBuildDisplayName(Job{Name: "test"}, 3, "v1.2.3")
+
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if config["displayName"] != "v1.2.3" || config["description"] != "deployed to staging" {
+		t.Errorf("submitted %v\n", config)
+	}
+}
+
+func TestGetBranchJobs(t *testing.T) {
+	var requested string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/app/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jobs": [{"name": "main"}, {"name": "feature%2Ffoo"}]}`)
+	})
+	mux.HandleFunc("/job/app/job/", func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.EscapedPath()
+		fmt.Fprint(w, `{"name": "feature%2Ffoo"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jobs, err := jenkins.GetBranchJobs("app")
+
+	if err != nil || len(jobs) != 2 || jobs[1].Name != "app/feature%2Ffoo" {
+		t.Errorf("jobs %+v, error %v\n", jobs, err)
+	}
+
+	if _, err := jenkins.GetJob(jobs[1].Name); err != nil || requested != "/job/app/job/feature%252Ffoo/api/json" {
+		t.Errorf("requested %s, error %v\n", requested, err)
+	}
+}
+
+func TestCreateFolder(t *testing.T) {
+	var created []string
+	mux := http.NewServeMux()
+	for _, path := range []string{"/createItem", "/job/team/createItem"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			created = append(created, r.URL.Path+" "+query.Get("name")+" "+query.Get("mode"))
+		})
+	}
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.CreateFolder("team"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.CreateFolder("team/services"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := []string{"/createItem team " + FolderClass, "/job/team/createItem services " + FolderClass}
+	if fmt.Sprint(created) != fmt.Sprint(expected) {
+		t.Errorf("created %v, expected %v\n", created, expected)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent string
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	if _, err := jenkins.GetJobs(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if userAgent != DefaultUserAgent {
+		t.Errorf("User-Agent %q, expected %q\n", userAgent, DefaultUserAgent)
+	}
+
+	jenkins.UserAgent = "release-bot/2.0"
+	if _, err := jenkins.GetJobs(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if userAgent != "release-bot/2.0" {
+		t.Errorf("User-Agent %q, expected %q\n", userAgent, "release-bot/2.0")
+	}
+}
+
+func TestBuildWithDelay(t *testing.T) {
+	var server *httptest.Server
+	var queries []string
+	mux := http.NewServeMux()
+	for _, path := range []string{"/job/test/build", "/job/test/buildWithParameters"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+			w.Header().Set("Location", server.URL+"/queue/item/9/")
+			w.WriteHeader(http.StatusCreated)
+		})
+	}
+	mux.HandleFunc("/queue/item/9/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 9}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	item, err := jenkins.BuildWithDelay(Job{Name: "test"}, nil, 90*time.Second)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if item.Id != 9 {
+		t.Errorf("item id %d, expected 9\n", item.Id)
+	}
+	if _, err := jenkins.BuildWithDelay(Job{Name: "test"}, url.Values{"env": []string{"prod"}}, 0); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := []string{"/job/test/build?delay=90sec", "/job/test/buildWithParameters?delay=0sec&env=prod"}
+	if fmt.Sprint(queries) != fmt.Sprint(expected) {
+		t.Errorf("queries %v, expected %v\n", queries, expected)
+	}
+}
+
+func TestBuildWithToken(t *testing.T) {
+	var server *httptest.Server
+	var query url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/buildWithParameters", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Location", server.URL+"/queue/item/9/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/queue/item/9/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 9}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	_, err := jenkins.BuildWithToken(Job{Name: "test"}, url.Values{"env": []string{"prod"}}, "s3cret", "release 1.2")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if query.Get("token") != "s3cret" || query.Get("cause") != "release 1.2" || query.Get("env") != "prod" {
+		t.Errorf("query %v\n", query)
+	}
+}
+
+func TestGetBuildEnvVars(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/3/injectedEnvVars/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"envMap": {"BUILD_NUMBER": "3", "GIT_BRANCH": "origin/main"}}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	envVars, err := jenkins.GetBuildEnvVars(Job{Name: "test"}, 3)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if envVars["GIT_BRANCH"] != "origin/main" || len(envVars) != 2 {
+		t.Errorf("env vars %v\n", envVars)
+	}
+
+	if _, err := jenkins.GetBuildEnvVars(Job{Name: "test"}, 4); err != ErrNoEnvVars {
+		t.Errorf("error %v, expected ErrNoEnvVars\n", err)
+	}
+}
+
+func TestGetBuildChangeSet(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/freestyle/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"changeSet": {"kind": "git", "items": [
+			{"commitId": "a1", "author": {"fullName": "Jane"}, "msg": "fix build", "affectedPaths": ["Makefile"]}
+		]}}`)
+	})
+	mux.HandleFunc("/job/pipeline/4/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"changeSets": [
+			{"kind": "git", "items": [{"commitId": "b1"}, {"commitId": "b2"}]},
+			{"kind": "git", "items": [{"commitId": "c1"}]}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	items, err := jenkins.GetBuildChangeSet(Build{Url: server.URL + "/job/freestyle/3/"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(items) != 1 || items[0].CommitId != "a1" || items[0].Author.FullName != "Jane" || items[0].AffectedPaths[0] != "Makefile" {
+		t.Errorf("items %+v\n", items)
+	}
+
+	items, err = jenkins.GetBuildChangeSet(Build{Url: server.URL + "/job/pipeline/4/"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(items) != 3 || items[2].CommitId != "c1" {
+		t.Errorf("items %+v\n", items)
+	}
+}
+
+func TestBuildLastBuiltRevision(t *testing.T) {
+	var build Build
+	data := `{"actions": [{"_class": "hudson.model.CauseAction"},
+		{"_class": "hudson.plugins.git.util.BuildData", "lastBuiltRevision": {"SHA1": "4f2c", "branch": [{"name": "origin/main", "SHA1": "4f2c"}]}}]}`
+	if err := json.Unmarshal([]byte(data), &build); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if build.LastBuiltRevision() != "4f2c" {
+		t.Errorf("revision %q, expected 4f2c\n", build.LastBuiltRevision())
+	}
+	if (Build{}).LastBuiltRevision() != "" {
+		t.Errorf("revision of a build without git checkout should be empty\n")
+	}
+}
+
+func TestWatchQueue(t *testing.T) {
+	polls := 0
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, `{"items": [{"id": %d}]}`, polls)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queues, errs := jenkins.WatchQueue(ctx, time.Millisecond)
+
+	if queue := <-queues; len(queue.Items) != 1 || queue.Items[0].Id != 1 {
+		t.Errorf("queue %+v\n", queue)
+	}
+	if err := <-errs; !isStatus(err, http.StatusInternalServerError) {
+		t.Errorf("error %v, expected a 500 HTTPError\n", err)
+	}
+	if queue := <-queues; len(queue.Items) != 1 || queue.Items[0].Id != 3 {
+		t.Errorf("queue %+v\n", queue)
+	}
+
+	cancel()
+	for range queues {
+	}
+	if _, ok := <-errs; ok {
+		t.Errorf("error channel should be closed after cancel\n")
+	}
+}
+
+func TestGetComputerLog(t *testing.T) {
+	mux := http.NewServeMux()
+	var agentPath string
+	mux.HandleFunc("/computer/", func(w http.ResponseWriter, r *http.Request) {
+		agentPath = r.URL.EscapedPath()
+		if agentPath != "/computer/build%20agent/log" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Agent successfully connected and online\n")
+	})
+	mux.HandleFunc("/computer/(master)/log", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "controller log\n")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	log, err := jenkins.GetComputerLog("build agent")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(log) != "Agent successfully connected and online\n" {
+		t.Errorf("log %q\n", log)
+	}
+	if agentPath != "/computer/build%20agent/log" {
+		t.Errorf("requested %s, expected the escaped node name\n", agentPath)
+	}
+
+	log, err = jenkins.GetComputerLog("master")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(log) != "controller log\n" {
+		t.Errorf("log %q\n", log)
+	}
+}
+
+func TestWipeoutWorkspace(t *testing.T) {
+	var wiped []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/idle/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"lastBuild": {"building": false}}`)
+	})
+	mux.HandleFunc("/job/busy/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"lastBuild": {"building": true}}`)
+	})
+	for _, path := range []string{"/job/idle/doWipeOutWorkspace", "/job/busy/doWipeOutWorkspace"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			wiped = append(wiped, r.URL.Path)
+		})
+	}
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.WipeoutWorkspace(Job{Name: "idle"}); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.WipeoutWorkspace(Job{Name: "busy"}); err == nil {
+		t.Errorf("expected an error for a building job\n")
+	}
+	if len(wiped) != 1 || wiped[0] != "/job/idle/doWipeOutWorkspace" {
+		t.Errorf("wiped %v\n", wiped)
+	}
+}
+
+func TestClearQueue(t *testing.T) {
+	var cancelled []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [{"id": 4}, {"id": 7}]}`)
+	})
+	mux.HandleFunc("/queue/cancelItem", func(w http.ResponseWriter, r *http.Request) {
+		cancelled = append(cancelled, r.URL.Query().Get("id"))
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.ClearQueue(); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if fmt.Sprint(cancelled) != "[4 7]" {
+		t.Errorf("cancelled %v\n", cancelled)
+	}
+}
+
+func TestIsBuilding(t *testing.T) {
+	var tree string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/5/api/json", func(w http.ResponseWriter, r *http.Request) {
+		tree = r.URL.Query().Get("tree")
+		fmt.Fprint(w, `{"_class": "hudson.model.FreeStyleBuild", "building": true}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	building, err := jenkins.IsBuilding(Job{Name: "test"}, 5)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !building {
+		t.Errorf("build should be building\n")
+	}
+	if tree != "building" {
+		t.Errorf("tree %q, expected building\n", tree)
+	}
+
+	if _, err := jenkins.IsBuilding(Job{Name: "test"}, 6); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a 404 HTTPError\n", err)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	var acceptEncoding string
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		fmt.Fprint(writer, `{"jobs": [{"name": "compressed"}]}`)
+		writer.Close()
+	}))
+	defer server.Close()
+
+	jobs, err := jenkins.GetJobs()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(jobs) != 1 || jobs[0].Name != "compressed" {
+		t.Errorf("jobs %+v\n", jobs)
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("Accept-Encoding %q, expected gzip\n", acceptEncoding)
+	}
+}
+
+func TestGetLastBuildNumber(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/built/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if tree := r.URL.Query().Get("tree"); tree != "lastBuild[number]" {
+			t.Errorf("tree %q\n", tree)
+		}
+		fmt.Fprint(w, `{"lastBuild": {"number": 42}}`)
+	})
+	mux.HandleFunc("/job/new/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"lastBuild": null}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	number, err := jenkins.GetLastBuildNumber(Job{Name: "built"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if number != 42 {
+		t.Errorf("number %d, expected 42\n", number)
+	}
+
+	if number, err := jenkins.GetLastBuildNumber(Job{Name: "new"}); number != 0 || err != ErrNoBuilds {
+		t.Errorf("number %d and error %v, expected 0 and ErrNoBuilds\n", number, err)
+	}
+}
+
+func TestBuildWithJSONParameters(t *testing.T) {
+	var server *httptest.Server
+	var contentType, payload string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/build", func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		payload = r.FormValue("json")
+		w.Header().Set("Location", server.URL+"/queue/item/9/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/queue/item/9/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 9}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	params := []BuildParameter{{Name: "env", Value: "prod"}, {Name: "regions", Value: []string{"eu", "us"}}}
+	item, err := jenkins.BuildWithJSONParameters(Job{Name: "test"}, params)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if item.Id != 9 {
+		t.Errorf("item id %d, expected 9\n", item.Id)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("content type %q\n", contentType)
+	}
+	expected := `{"parameter":[{"name":"env","value":"prod"},{"name":"regions","value":["eu","us"]}]}`
+	if payload != expected {
+		t.Errorf("json %s, expected %s\n", payload, expected)
+	}
+}
+
+func TestBuildWithFileParameters(t *testing.T) {
+	var server *httptest.Server
+	var payload, upload, uploadName string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/build", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("error %v\n", err)
+		}
+		payload = r.FormValue("json")
+		file, header, err := r.FormFile("file0")
+		if err != nil {
+			t.Errorf("error %v\n", err)
+		} else {
+			data, _ := ioutil.ReadAll(file)
+			upload, uploadName = string(data), header.Filename
+		}
+		w.Header().Set("Location", server.URL+"/queue/item/9/")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/queue/item/9/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 9}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	files := map[string]io.Reader{"settings.xml": strings.NewReader("<settings/>")}
+	item, err := jenkins.BuildWithFileParameters(Job{Name: "test"}, url.Values{"env": []string{"prod"}}, files)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if item.Id != 9 {
+		t.Errorf("item id %d, expected 9\n", item.Id)
+	}
+	expected := `{"parameter":[{"name":"env","value":"prod"},{"file":"file0","name":"settings.xml"}]}`
+	if payload != expected {
+		t.Errorf("json %s, expected %s\n", payload, expected)
+	}
+	if upload != "<settings/>" || uploadName != "settings.xml" {
+		t.Errorf("uploaded %q as %q\n", upload, uploadName)
+	}
+}
+
+func TestGetCrumb(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "abc123"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	field, value, err := jenkins.GetCrumb()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if field != "Jenkins-Crumb" || value != "abc123" {
+		t.Errorf("crumb %s: %s\n", field, value)
+	}
+
+	disabled, disabledServer := newTestJenkins(http.NotFoundHandler())
+	defer disabledServer.Close()
+
+	if _, _, err := disabled.GetCrumb(); err != ErrCrumbIssuerDisabled {
+		t.Errorf("error %v, expected ErrCrumbIssuerDisabled\n", err)
+	}
+}
+
+func TestGetComputerLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computer/agent-1/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"displayName": "agent-1", "assignedLabels": [{"name": "agent-1"}, {"name": "docker"}, {"name": "linux"}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	labels, err := jenkins.GetComputerLabels("agent-1")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if fmt.Sprint(labels) != "[agent-1 docker linux]" {
+		t.Errorf("labels %v\n", labels)
+	}
+}
+
+func TestGetJobAssignedNode(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/pinned/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.1" encoding="UTF-8"?><project><assignedNode>linux &amp;&amp; docker</assignedNode><canRoam>false</canRoam></project>`)
+	})
+	mux.HandleFunc("/job/roaming/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<flow-definition><description/></flow-definition>`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	node, err := jenkins.GetJobAssignedNode("pinned")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if node != "linux && docker" {
+		t.Errorf("assigned node %q\n", node)
+	}
+
+	node, err = jenkins.GetJobAssignedNode("roaming")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if node != "" {
+		t.Errorf("assigned node %q, expected none\n", node)
+	}
+}
+
+func TestGetJobsWithLastBuild(t *testing.T) {
+	var tree string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		tree = r.URL.Query().Get("tree")
+		fmt.Fprint(w, `{"jobs": [
+			{"name": "api", "color": "blue", "lastBuild": {"number": 12, "result": "SUCCESS", "timestamp": 1700000000000, "duration": 61000}},
+			{"name": "new", "color": "notbuilt", "lastBuild": null}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jobs, err := jenkins.GetJobsWithLastBuild()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if tree != "jobs[name,url,color,lastBuild[number,result,timestamp,duration]]" {
+		t.Errorf("tree %q\n", tree)
+	}
+	if len(jobs) != 2 || jobs[0].LastBuild.Number != 12 || jobs[0].LastBuild.Duration != 61000 || jobs[1].LastBuild.Number != 0 {
+		t.Errorf("jobs %+v\n", jobs)
+	}
+}
+
+func TestGetLabel(t *testing.T) {
+	var requested string
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		fmt.Fprint(w, `{"name": "linux && docker", "busyExecutors": 3, "idleExecutors": 1, "totalExecutors": 4,
+			"offline": false, "nodes": [{"nodeName": "agent-1"}, {"nodeName": "agent-2"}]}`)
+	}))
+	defer server.Close()
+
+	label, err := jenkins.GetLabel("linux && docker")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if requested != "/label/linux && docker/api/json" {
+		t.Errorf("requested %q\n", requested)
+	}
+	if label.TotalExecutors != 4 || label.IdleExecutors != 1 || len(label.Nodes) != 2 || label.Nodes[1].NodeName != "agent-2" {
+		t.Errorf("label %+v\n", label)
+	}
+}
+
+func TestGetExecutorStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"busyExecutors": 5, "totalExecutors": 8}`)
+	})
+	mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	stats, err := jenkins.GetExecutorStats()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if stats != (ExecutorStats{TotalExecutors: 8, BusyExecutors: 5, QueueLength: 3}) {
+		t.Errorf("stats %+v\n", stats)
+	}
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	var header http.Header
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/description", func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	jenkins.DefaultHeaders = http.Header{}
+	jenkins.DefaultHeaders.Set("X-Forwarded-User", "deploy-bot")
+	jenkins.DefaultHeaders.Set("Content-Type", "text/plain")
+
+	if err := jenkins.SetJobDescription("test", "deployed"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if header.Get("X-Forwarded-User") != "deploy-bot" {
+		t.Errorf("X-Forwarded-User %q\n", header.Get("X-Forwarded-User"))
+	}
+	if header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type %q should not be replaced\n", header.Get("Content-Type"))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/j_spring_security_check", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("j_username") != "jane" || r.FormValue("j_password") != "s3cret" {
+			http.Redirect(w, r, "/loginError", http.StatusFound)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "session-1", Path: "/"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		// Like instances which deny anonymous read access.
+		if _, err := r.Cookie("JSESSIONID"); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "session-crumb"}`)
+	})
+	var description string
+	mux.HandleFunc("/job/test/description", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Jenkins-Crumb") != "session-crumb" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		description = r.FormValue("description")
+	})
+	mux.HandleFunc("/loginError", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Invalid username or password")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Dashboard")
+	})
+	mux.HandleFunc("/me/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("JSESSIONID"); err != nil || cookie.Value != "session-1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"id": "jane"}`)
+	})
+	mux.HandleFunc("/whoAmI/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("JSESSIONID"); err != nil {
+			fmt.Fprint(w, `{"name": "anonymous", "anonymous": true}`)
+			return
+		}
+		fmt.Fprint(w, `{"name": "jane", "anonymous": false}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.Login("jane", "wrong"); err != ErrLoginFailed {
+		t.Errorf("error %v, expected ErrLoginFailed\n", err)
+	}
+	if err := jenkins.Login("jane", "s3cret"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if http.DefaultClient.Jar != nil {
+		t.Errorf("Login should not give http.DefaultClient a cookie jar\n")
+	}
+
+	user, err := jenkins.WhoAmI()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if user.Id != "jane" {
+		t.Errorf("user %+v\n", user)
+	}
+
+	if err := jenkins.SetJobDescription("test", "logged in"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if description != "logged in" {
+		t.Errorf("description %q, expected a POST with the crumb of the session\n", description)
+	}
+}
+
+func TestGetBuildNumberFromQueueItem(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/item/1/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "why": "Waiting for next available executor"}`)
+	})
+	mux.HandleFunc("/queue/item/2/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 2, "cancelled": true}`)
+	})
+	mux.HandleFunc("/queue/item/3/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 3, "executable": {"number": 17, "url": "http://jenkins/job/test/17/"}}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if _, err := jenkins.GetBuildNumberFromQueueItem(Item{Id: 1}); err != ErrQueueItemPending {
+		t.Errorf("error %v, expected ErrQueueItemPending\n", err)
+	}
+	if _, err := jenkins.GetBuildNumberFromQueueItem(Item{Id: 2}); err != ErrQueueItemCancelled {
+		t.Errorf("error %v, expected ErrQueueItemCancelled\n", err)
+	}
+	number, err := jenkins.GetBuildNumberFromQueueItem(Item{Id: 3})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if number != 17 {
+		t.Errorf("number %d, expected 17\n", number)
+	}
+}
+
+func TestViewConfigXML(t *testing.T) {
+	config := `<hudson.model.ListView><name>release</name></hudson.model.ListView>`
+	var updated string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/release/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			data, _ := ioutil.ReadAll(r.Body)
+			updated = string(data)
+			return
+		}
+		fmt.Fprint(w, config)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	data, err := jenkins.GetViewConfigXML("release")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(data) != config {
+		t.Errorf("config %s\n", data)
+	}
+
+	if err := jenkins.UpdateViewConfigXML("release", strings.NewReader(config)); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if updated != config {
+		t.Errorf("updated config %s\n", updated)
+	}
+
+	if _, err := jenkins.GetViewConfigXML("missing"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a 404 HTTPError\n", err)
+	}
+	if err := jenkins.UpdateViewConfigXML("missing", strings.NewReader(config)); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a 404 HTTPError\n", err)
+	}
+}
+
+func TestGetListView(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/view/release/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version='1.1' encoding='UTF-8'?>
+<hudson.model.ListView>
+  <name>release</name>
+  <filterExecutors>false</filterExecutors>
+  <filterQueue>true</filterQueue>
+  <properties class="hudson.model.View$PropertyList"/>
+  <jobNames>
+    <comparator class="hudson.util.CaseInsensitiveComparator"/>
+    <string>deploy</string>
+    <string>smoke-test</string>
+  </jobNames>
+  <jobFilters/>
+  <columns>
+    <hudson.views.StatusColumn/>
+    <hudson.views.JobColumn/>
+    <jenkins.branch.DescriptionColumn/>
+  </columns>
+  <includeRegex>release-.*</includeRegex>
+  <recurse>true</recurse>
+</hudson.model.ListView>`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	view, err := jenkins.GetListView("release")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if view.Name != "release" || !view.FilterQueue || view.IncludeRegex != "release-.*" || !view.Recurse {
+		t.Errorf("view %+v\n", view)
+	}
+	if fmt.Sprint(view.JobNames) != "[deploy smoke-test]" {
+		t.Errorf("job names %v\n", view.JobNames)
+	}
+	if len(view.Columns.Column) != 3 {
+		t.Fatalf("columns %+v\n", view.Columns.Column)
+	}
+	if _, ok := view.Columns.Column[0].(*StatusColumn); !ok {
+		t.Errorf("first column %T, expected *StatusColumn\n", view.Columns.Column[0])
+	}
+
+	data, err := xml.Marshal(view)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	expected := `<columns><hudson.views.StatusColumn></hudson.views.StatusColumn><hudson.views.JobColumn></hudson.views.JobColumn>` +
+		`<jenkins.branch.DescriptionColumn></jenkins.branch.DescriptionColumn></columns>`
+	if !strings.Contains(string(data), expected) || !strings.Contains(string(data), `<includeRegex>release-.*</includeRegex><recurse>true</recurse>`) {
+		t.Errorf("marshalled view %s\n", data)
+	}
+}
+
+func TestListViewJobFilters(t *testing.T) {
+	filter := `<hudson.views.RegExJobFilter plugin="view-job-filters@2.3">` +
+		`<includeExcludeTypeString>includeMatched</includeExcludeTypeString>` +
+		`<valueTypeString>NAME</valueTypeString><regex>release-.*</regex></hudson.views.RegExJobFilter>`
+	config := `<hudson.model.ListView><name>release</name><jobFilters>` + filter + `</jobFilters></hudson.model.ListView>`
+
+	var view ListView
+	if err := xml.Unmarshal([]byte(config), &view); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(view.JobFilters.Filter) != 1 {
+		t.Fatalf("job filters %+v\n", view.JobFilters.Filter)
+	}
+	raw, ok := view.JobFilters.Filter[0].(*RawJobFilter)
+	if !ok || raw.XMLName.Local != "hudson.views.RegExJobFilter" {
+		t.Errorf("job filter %+v\n", view.JobFilters.Filter[0])
+	}
+
+	data, err := xml.Marshal(view)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !strings.Contains(string(data), `<jobFilters>`+filter+`</jobFilters>`) {
+		t.Errorf("marshalled view %s\n", data)
+	}
+}
+
+func TestGetPipelineStages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/pipeline/3/wfapi/describe", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "3", "name": "#3", "status": "FAILED", "stages": [
+			{"id": "6", "name": "Build", "status": "SUCCESS", "startTimeMillis": 1700000000000, "durationMillis": 42000},
+			{"id": "14", "name": "Test", "status": "FAILED", "startTimeMillis": 1700000042000, "durationMillis": 9000}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	stages, err := jenkins.GetPipelineStages(Job{Name: "pipeline"}, 3)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(stages) != 2 || stages[1].Name != "Test" || stages[1].Status != "FAILED" || stages[0].DurationMillis != 42000 {
+		t.Errorf("stages %+v\n", stages)
+	}
+
+	if _, err := jenkins.GetPipelineStages(Job{Name: "freestyle"}, 1); err != ErrNotPipeline {
+		t.Errorf("error %v, expected ErrNotPipeline\n", err)
+	}
+}
+
+func TestGetPipelineNodeLog(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/pipeline/3/execution/node/14/log", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "+ make test\nFAIL: TestParse\n")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	log, err := jenkins.GetPipelineNodeLog(Job{Name: "pipeline"}, 3, "14")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(log) != "+ make test\nFAIL: TestParse\n" {
+		t.Errorf("log %q\n", log)
+	}
+
+	if _, err := jenkins.GetPipelineNodeLog(Job{Name: "pipeline"}, 3, "99"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a 404 HTTPError\n", err)
+	}
+}
+
+func TestReplayBuild(t *testing.T) {
+	var script, config string
+	nextBuildNumber := 4
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/team/job/pipeline/3/replay", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><form action="run" method="post">
+			<textarea name="_.mainScript" class="script">node { sh &quot;make &amp;&amp; make test&quot; }</textarea>
+		</form></html>`)
+	})
+	mux.HandleFunc("/job/team/job/pipeline/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if tree := r.URL.Query().Get("tree"); tree != "nextBuildNumber" {
+			t.Errorf("tree %q\n", tree)
+		}
+		fmt.Fprintf(w, `{"nextBuildNumber": %d}`, nextBuildNumber)
+	})
+	mux.HandleFunc("/job/team/job/pipeline/3/replay/run", func(w http.ResponseWriter, r *http.Request) {
+		script, config = r.FormValue("mainScript"), r.FormValue("json")
+		// With a free executor the replay starts at once and never shows up in the queue.
+		nextBuildNumber++
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	number, err := jenkins.ReplayBuild(Job{Name: "team/pipeline"}, 3)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if number != 4 {
+		t.Errorf("build number %d, expected 4\n", number)
+	}
+	if script != `node { sh "make && make test" }` {
+		t.Errorf("script %q\n", script)
+	}
+	var submitted map[string]string
+	if err := json.Unmarshal([]byte(config), &submitted); err != nil || submitted["mainScript"] != script {
+		t.Errorf("json %s\n", config)
+	}
+
+	if _, err := jenkins.ReplayBuild(Job{Name: "team/pipeline"}, 2); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a 404 HTTPError\n", err)
+	}
+}
+
+func TestGetBuildCauses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/deploy/8/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 8, "actions": [
+			{"_class": "hudson.model.CauseAction", "causes": [
+				{"_class": "hudson.model.Cause$UpstreamCause", "shortDescription": "Started by upstream project \"build\" build number 21",
+					"upstreamProject": "build", "upstreamBuild": 21, "upstreamUrl": "job/build/"},
+				{"_class": "hudson.model.Cause$UserIdCause", "shortDescription": "Started by user Jane", "userId": "jane", "userName": "Jane"}
+			]},
+			{},
+			{"_class": "hudson.plugins.git.util.BuildData"}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	causes, err := jenkins.GetBuildCauses(Build{Url: server.URL + "/job/deploy/8/"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(causes) != 2 {
+		t.Fatalf("causes %+v\n", causes)
+	}
+	if causes[0].UpstreamProject != "build" || causes[0].UpstreamBuild != 21 || causes[0].UpstreamUrl != "job/build/" {
+		t.Errorf("upstream cause %+v\n", causes[0])
+	}
+	if causes[1].Class != "hudson.model.Cause$UserIdCause" || causes[1].UserId != "jane" {
+		t.Errorf("user cause %+v\n", causes[1])
+	}
+}
+
+func TestEnsureJob(t *testing.T) {
+	config := `<project><description>managed</description></project>`
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/existing/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, "update existing "+string(data))
+	})
+	mux.HandleFunc("/job/team/createItem", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, "create "+r.URL.Query().Get("name")+" "+string(data))
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	created, err := jenkins.EnsureJob("existing", strings.NewReader(config))
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if created {
+		t.Errorf("existing job should have been updated\n")
+	}
+
+	created, err = jenkins.EnsureJob("team/new", strings.NewReader(config))
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !created {
+		t.Errorf("missing job should have been created\n")
+	}
+
+	expected := []string{"update existing " + config, "create new " + config}
+	if fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Errorf("requests %v, expected %v\n", requests, expected)
+	}
+}
+
+func TestPollSCM(t *testing.T) {
+	polled := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/polling/polling", func(w http.ResponseWriter, r *http.Request) {
+		polled = r.Method == "POST"
+	})
+	mux.HandleFunc("/job/disabled/polling", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.PollSCM(Job{Name: "polling"}); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !polled {
+		t.Errorf("job should have been asked to poll\n")
+	}
+	if err := jenkins.PollSCM(Job{Name: "disabled"}); err != ErrJobDisabled {
+		t.Errorf("error %v, expected ErrJobDisabled\n", err)
+	}
+	if err := jenkins.PollSCM(Job{Name: "manual"}); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("error %v, expected a wrapped 404 HTTPError\n", err)
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	tests := []struct {
+		color    string
+		status   JobStatus
+		building bool
+	}{
+		{"blue", JobStatusSuccess, false},
+		{"red_anime", JobStatusFailed, true},
+		{"yellow", JobStatusUnstable, false},
+		{"aborted", JobStatusAborted, false},
+		{"disabled", JobStatusDisabled, false},
+		{"notbuilt_anime", JobStatusNotBuilt, true},
+		{"", JobStatusUnknown, false},
+	}
+
+	for _, test := range tests {
+		job := Job{Color: test.color}
+		if job.Status() != test.status {
+			t.Errorf("status of %q is %d, expected %d\n", test.color, job.Status(), test.status)
+		}
+		if job.IsBuilding() != test.building {
+			t.Errorf("building of %q is %t, expected %t\n", test.color, job.IsBuilding(), test.building)
+		}
+	}
+}
+
+func TestSystemConfigXML(t *testing.T) {
+	config := `<hudson><numExecutors>2</numExecutors></hudson>`
+	var updated string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config.xml", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			data, _ := ioutil.ReadAll(r.Body)
+			updated = string(data)
+			return
+		}
+		fmt.Fprint(w, config)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	data, err := jenkins.GetSystemConfigXML()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(data) != config {
+		t.Errorf("config %s\n", data)
+	}
+	if err := jenkins.UpdateSystemConfigXML(strings.NewReader(config)); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if updated != config {
+		t.Errorf("updated config %s\n", updated)
+	}
+
+	forbidden, forbiddenServer := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbiddenServer.Close()
+
+	if _, err := forbidden.GetSystemConfigXML(); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, expected ErrPermissionDenied\n", err)
+	}
+	if err := forbidden.UpdateSystemConfigXML(strings.NewReader(config)); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, expected ErrPermissionDenied\n", err)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	var script string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scriptText", func(w http.ResponseWriter, r *http.Request) {
+		script = r.FormValue("script")
+		fmt.Fprint(w, "2.401.1\n")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	output, err := jenkins.RunScript(`println(Jenkins.VERSION)`)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if output != "2.401.1\n" {
+		t.Errorf("output %q\n", output)
+	}
+	if script != `println(Jenkins.VERSION)` {
+		t.Errorf("script %q\n", script)
+	}
+
+	forbidden, forbiddenServer := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbiddenServer.Close()
+
+	if _, err := forbidden.RunScript(`println("hi")`); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, expected ErrPermissionDenied\n", err)
+	}
+}
+
+func TestGetAllBuildsAcrossJobs(t *testing.T) {
+	var tree string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		tree = r.URL.Query().Get("tree")
+		fmt.Fprint(w, `{"jobs": [
+			{"name": "api", "builds": [{"number": 12, "result": "SUCCESS"}, {"number": 11, "result": "FAILURE"}]},
+			{"name": "new", "builds": []}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	builds, err := jenkins.GetAllBuildsAcrossJobs("number,result", 2)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if tree != "jobs[name,builds[number,result]{0,2}]" {
+		t.Errorf("tree %q\n", tree)
+	}
+	if len(builds) != 2 || len(builds["api"]) != 2 || builds["api"][1].Result != "FAILURE" || len(builds["new"]) != 0 {
+		t.Errorf("builds %+v\n", builds)
+	}
+
+	if _, err := jenkins.GetAllBuildsAcrossJobs("", 5); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if tree != "jobs[name,builds[number,result,timestamp,duration,url]{0,5}]" {
+		t.Errorf("default tree %q\n", tree)
+	}
+}
+
+func TestGetBuildConsoleOutputContext(t *testing.T) {
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/consoleText", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Started by user Jane\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := jenkins.GetBuildConsoleOutputContext(ctx, Build{Url: server.URL + "/job/test/1/"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, expected context.DeadlineExceeded\n", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("reading the console output should stop when ctx is done\n")
+	}
+}
+
+func TestDeleteBuild(t *testing.T) {
+	deleted := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/3/doDelete", func(w http.ResponseWriter, r *http.Request) {
+		deleted = r.Method == "POST"
+		http.Redirect(w, r, "/job/test/", http.StatusFound)
+	})
+	mux.HandleFunc("/job/test/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>test</html>")
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.DeleteBuild(Job{Name: "test"}, 3); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !deleted {
+		t.Errorf("build should have been deleted\n")
+	}
+	if err := jenkins.DeleteBuild(Job{Name: "other"}, 4); err != ErrNoBuilds {
+		t.Errorf("error %v, expected ErrNoBuilds\n", err)
+	}
+}
+
+func TestSetKeepBuild(t *testing.T) {
+	keepLog := false
+	toggles := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/release/7/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keepLog": %t}`, keepLog)
+	})
+	mux.HandleFunc("/job/release/7/toggleLogKeep", func(w http.ResponseWriter, r *http.Request) {
+		keepLog = !keepLog
+		toggles++
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	for _, keep := range []bool{true, true, false} {
+		if err := jenkins.SetKeepBuild(Job{Name: "release"}, 7, keep); err != nil {
+			t.Errorf("error %v\n", err)
+		}
+		if keepLog != keep {
+			t.Errorf("keepLog %t, expected %t\n", keepLog, keep)
+		}
+	}
+	if toggles != 2 {
+		t.Errorf("toggled %d times, expected 2\n", toggles)
+	}
+
+	if err := jenkins.ToggleKeepBuild(Job{Name: "release"}, 7); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if !keepLog {
+		t.Errorf("ToggleKeepBuild should keep the build\n")
+	}
+}
+
+func TestGetQueueLength(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		if tree := r.URL.Query().Get("tree"); tree != "items[id]" {
+			t.Errorf("tree %q\n", tree)
+		}
+		fmt.Fprint(w, `{"_class": "hudson.model.Queue", "items": [{"id": 4}, {"id": 5}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	length, err := jenkins.GetQueueLength()
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if length != 2 {
+		t.Errorf("length %d, expected 2\n", length)
+	}
+}
+
+func TestGetBuildWithParams(t *testing.T) {
+	var query url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/5/api/json", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"number": 5, "result": "SUCCESS"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	params := url.Values{"tree": []string{"number,result"}, "depth": []string{"1"}}
+	build, err := jenkins.GetBuildWithParams(Job{Name: "test"}, 5, params)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if build.Number != 5 || build.Result != "SUCCESS" {
+		t.Errorf("build %+v\n", build)
+	}
+	if query.Get("tree") != "number,result" || query.Get("depth") != "1" {
+		t.Errorf("query %v\n", query)
+	}
+}
+
+func TestGetJobByUrl(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jenkins/job/team/job/deploy/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "deploy", "color": "blue"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	jenkins := NewJenkins(&Auth{}, server.URL+"/jenkins")
+
+	job, err := jenkins.GetJobByUrl(server.URL + "/jenkins/job/team/job/deploy/")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if job.Name != "deploy" {
+		t.Errorf("job %+v\n", job)
+	}
+
+	for _, jobUrl := range []string{"http://elsewhere.example.com/jenkins/job/deploy/", server.URL + "/jenkins-old/job/deploy/", server.URL + "/job/deploy/"} {
+		if _, err := jenkins.GetJobByUrl(jobUrl); err == nil {
+			t.Errorf("expected an error for %s\n", jobUrl)
+		}
+	}
+}
+
+func TestGetBuildByUrl(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/team/job/deploy/12/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 12, "result": "SUCCESS"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	build, err := jenkins.GetBuildByUrl(server.URL + "/job/team/job/deploy/12/")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if build.Number != 12 || build.Result != "SUCCESS" {
+		t.Errorf("build %+v\n", build)
+	}
+
+	if _, err := jenkins.GetBuildByUrl("http://elsewhere.example.com/job/deploy/12/"); err == nil {
+		t.Errorf("expected an error for a url of another server\n")
+	}
+}
+
+func TestGetUpstreamBuilds(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/deploy/8/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 8, "actions": [{"causes": [
+			{"_class": "hudson.model.Cause$UpstreamCause", "upstreamProject": "team/build", "upstreamBuild": 21, "upstreamUrl": "job/team/job/build/"}
+		]}]}`)
+	})
+	mux.HandleFunc("/job/team/job/build/21/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 21, "result": "SUCCESS"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	builds, err := jenkins.GetUpstreamBuilds(Build{Url: server.URL + "/job/deploy/8/"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(builds) != 1 || builds[0].Number != 21 {
+		t.Errorf("builds %+v\n", builds)
+	}
+}
+
+func TestGetDownstreamBuilds(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/team/job/build/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"fullName": "team/build", "downstreamProjects": [{"url": "%s/job/deploy/"}]}`, server.URL)
+	})
+	mux.HandleFunc("/job/deploy/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"builds": [
+			{"number": 9, "url": "%[1]s/job/deploy/9/", "actions": [{"causes": [{"upstreamProject": "team/build", "upstreamBuild": 22}]}]},
+			{"number": 8, "url": "%[1]s/job/deploy/8/", "actions": [{"causes": [{"upstreamProject": "team/build", "upstreamBuild": 21}]}]},
+			{"number": 7, "url": "%[1]s/job/deploy/7/", "actions": [{"causes": [{"userId": "jane"}]}]}
+		]}`, server.URL)
+	})
+	mux.HandleFunc("/job/deploy/8/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 8, "result": "SUCCESS"}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	builds, err := jenkins.GetDownstreamBuilds(Build{Number: 21, Url: server.URL + "/job/team/job/build/21/"})
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(builds) != 1 || builds[0].Number != 8 || builds[0].Result != "SUCCESS" {
+		t.Errorf("builds %+v\n", builds)
+	}
+}
+
+func TestGetFingerprint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fingerprint/5d41402abc4b2a76b9719d911017c592/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"fileName": "app.jar", "hash": "5d41402abc4b2a76b9719d911017c592",
+			"original": {"name": "team/build", "number": 21},
+			"usage": [{"name": "deploy", "ranges": {"ranges": [{"start": 8, "end": 10}, {"start": 12, "end": 13}]}}]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	fingerprint, err := jenkins.GetFingerprint("5d41402abc4b2a76b9719d911017c592")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if fingerprint.FileName != "app.jar" || fingerprint.Original == nil || fingerprint.Original.Number != 21 {
+		t.Errorf("fingerprint %+v\n", fingerprint)
+	}
+	if len(fingerprint.Usage) != 1 || fmt.Sprint(fingerprint.Usage[0].Numbers()) != "[8 9 12]" {
+		t.Errorf("usage %+v\n", fingerprint.Usage)
+	}
+}
+
+func TestBaseUrlTrailingSlash(t *testing.T) {
+	tests := []struct {
+		baseUrl  string
+		expected string
+	}{
+		{"http://ci.example.com", "http://ci.example.com/job/foo/api/json"},
+		{"http://ci.example.com/", "http://ci.example.com/job/foo/api/json"},
+		{"http://ci.example.com/jenkins/", "http://ci.example.com/jenkins/job/foo/api/json"},
+	}
+
+	for _, test := range tests {
+		jenkins := NewJenkins(&Auth{}, test.baseUrl)
+		if requestUrl := jenkins.buildUrl(jobPath("foo"), nil); requestUrl != test.expected {
+			t.Errorf("url for %s is %s, expected %s\n", test.baseUrl, requestUrl, test.expected)
+		}
+	}
+}
+
+func TestSpecialCharactersAreEscaped(t *testing.T) {
+	var server *httptest.Server
+	var requested []string
+	jenkins, server := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/crumbIssuer/") {
+			http.NotFound(w, r)
+			return
+		}
+		requested = append(requested, r.Method+" "+r.URL.EscapedPath())
+		if strings.HasSuffix(r.URL.Path, "/build") {
+			w.Header().Set("Location", server.URL+"/queue/item/9/")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	job := Job{Name: "team #1/my job"}
+	if _, err := jenkins.GetJob(job.Name); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if _, err := jenkins.GetBuild(job, 3); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if _, err := jenkins.Build(job, nil); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.DeleteJob(job.Name); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if _, err := jenkins.GetView("release #2"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.DeleteView("release #2"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	expected := []string{
+		"GET /job/team%20%231/job/my%20job/api/json",
+		"GET /job/team%20%231/job/my%20job/3/api/json",
+		"POST /job/team%20%231/job/my%20job/build",
+		"GET /queue/item/9/api/json",
+		"POST /job/team%20%231/job/my%20job/doDelete",
+		"GET /view/release%20%232/api/json",
+		"POST /view/release%20%232/doDelete",
+	}
+	if strings.Join(requested, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("requested\n%s\nexpected\n%s\n", strings.Join(requested, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestGetBuildConsoleTail(t *testing.T) {
+	output := strings.Repeat("building...\n", 1000) + "ERROR: tests failed\n"
+	var starts []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/test/1/logText/progressiveText", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Text-Size", strconv.Itoa(len(output)))
+		if r.Method == "HEAD" {
+			return
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		starts = append(starts, strconv.Itoa(start))
+		fmt.Fprint(w, output[start:])
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	tail, err := jenkins.GetBuildConsoleTail(Build{Url: server.URL + "/job/test/1"}, 20)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(tail) != "ERROR: tests failed\n" {
+		t.Errorf("tail %q\n", tail)
+	}
+	if len(starts) != 1 || starts[0] != strconv.Itoa(len(output)-20) {
+		t.Errorf("fetched from %v, expected only the last 20 bytes\n", starts)
+	}
+
+	tail, err = jenkins.GetBuildConsoleTail(Build{Url: server.URL + "/job/test/1"}, int64(len(output))+100)
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if string(tail) != output {
+		t.Errorf("tail of %d bytes, expected the whole output of %d bytes\n", len(tail), len(output))
+	}
+}
+
+func TestGetJobHealth(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/job/flaky/api/json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"healthReport": [
+			{"description": "Build stability: 4 out of the last 5 builds failed.", "score": 20,
+				"iconClassName": "icon-health-00to19", "iconUrl": "health-00to19.png"}
+		]}`)
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	health, err := jenkins.GetJobHealth("flaky")
+	if err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if len(health) != 1 || health[0].Score != 20 || health[0].IconClassName != "icon-health-00to19" ||
+		health[0].Description != "Build stability: 4 out of the last 5 builds failed." {
+		t.Errorf("health %+v\n", health)
+	}
+}
+
+func TestConcurrentCrumbFetch(t *testing.T) {
+	var mutex sync.Mutex
+	crumbFetches, stops := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		crumbFetches++
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "abc123"}`)
+	})
+	mux.HandleFunc("/job/test/1/stop", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Jenkins-Crumb") != "abc123" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mutex.Lock()
+		stops++
+		mutex.Unlock()
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := jenkins.StopBuild(Job{Name: "test"}, 1); err != nil {
+				t.Errorf("error %v\n", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if crumbFetches != 1 {
+		t.Errorf("crumb fetched %d times, expected once\n", crumbFetches)
+	}
+	if stops != 50 {
+		t.Errorf("%d stops, expected 50\n", stops)
+	}
+}
+
+func TestExpiredCrumbIsRefetched(t *testing.T) {
+	var mutex sync.Mutex
+	crumbValue, crumbFetches := "crumb-1", 0
+	var descriptions []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		crumbFetches++
+		fmt.Fprintf(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "%s"}`, crumbValue)
+	})
+	mux.HandleFunc("/job/test/description", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Header.Get("Jenkins-Crumb") != crumbValue {
+			http.Error(w, "No valid crumb was included in the request", http.StatusForbidden)
+			return
+		}
+		descriptions = append(descriptions, r.FormValue("description"))
+	})
+	jenkins, server := newTestJenkins(mux)
+	defer server.Close()
+
+	if err := jenkins.SetJobDescription("test", "before restart"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	// Jenkins restarted and issues new crumbs.
+	mutex.Lock()
+	crumbValue = "crumb-2"
+	mutex.Unlock()
+
+	if err := jenkins.SetJobDescription("test", "after restart"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+	if err := jenkins.SetJobDescription("test", "with the new crumb"); err != nil {
+		t.Errorf("error %v\n", err)
+	}
+
+	if crumbFetches != 2 {
+		t.Errorf("crumb fetched %d times, expected 2\n", crumbFetches)
+	}
+	expected := []string{"before restart", "after restart", "with the new crumb"}
+	if fmt.Sprint(descriptions) != fmt.Sprint(expected) {
+		t.Errorf("descriptions %v, expected %v\n", descriptions, expected)
+	}
+
+	forbidden, forbiddenServer := newTestJenkins(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crumbIssuer/api/json" {
+			fmt.Fprint(w, `{"crumbRequestField": "Jenkins-Crumb", "crumb": "valid"}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer forbiddenServer.Close()
+
+	if err := forbidden.SetJobDescription("test", "denied"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, expected ErrPermissionDenied after a single retry\n", err)
+	}
+}
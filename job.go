@@ -1,6 +1,10 @@
 package gojenkins
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
 
 type Artifact struct {
 	DisplayPath  string `json:"displayPath"`
@@ -13,21 +17,74 @@ type Build struct {
 	Number int    `json:"number"`
 	Url    string `json:"url"`
 
+	DisplayName     string `json:"displayName"`
 	FullDisplayName string `json:"fullDisplayName"`
 	Description     string `json:"description"`
 
-	Timestamp         int `json:"timestamp"`
-	Duration          int `json:"duration"`
-	EstimatedDuration int `json:"estimatedDuration"`
+	// Timestamp is when the build started, in milliseconds since the epoch.
+	Timestamp int64 `json:"timestamp"`
+	// Duration and EstimatedDuration are in milliseconds.
+	Duration          int64 `json:"duration"`
+	EstimatedDuration int64 `json:"estimatedDuration"`
 
-	Building bool   `json:"building"`
-	KeepLog  bool   `json:"keepLog"`
-	Result   string `json:"result"`
+	Building bool `json:"building"`
+	KeepLog  bool `json:"keepLog"`
+	// Result is one of SUCCESS, UNSTABLE, FAILURE, NOT_BUILT or ABORTED, and empty while building.
+	Result string `json:"result"`
 
 	Artifacts []Artifact `json:"artifacts"`
+	Actions   []Action   `json:"actions"`
+
+	// ChangeSet is set for freestyle builds and ChangeSets, one per checkout, for pipeline builds.
+	ChangeSet  ChangeSet   `json:"changeSet"`
+	ChangeSets []ChangeSet `json:"changeSets"`
+}
+
+// ChangeSet holds the commits a build picked up since the previous one.
+// Kind is the SCM, e.g. git.
+type ChangeSet struct {
+	Kind  string          `json:"kind"`
+	Items []ChangeSetItem `json:"items"`
+}
+
+type ChangeSetItem struct {
+	CommitId string          `json:"commitId"`
+	Author   ChangeSetAuthor `json:"author"`
+	Msg      string          `json:"msg"`
+	Comment  string          `json:"comment"`
+	// Timestamp is when the commit was made, in milliseconds since the epoch.
+	Timestamp     int64    `json:"timestamp"`
+	AffectedPaths []string `json:"affectedPaths"`
+}
+
+type ChangeSetAuthor struct {
+	FullName    string `json:"fullName"`
+	AbsoluteUrl string `json:"absoluteUrl"`
+}
+
+// IsSuccess reports whether the build has finished successfully.
+func (build Build) IsSuccess() bool {
+	return !build.Building && build.Result == "SUCCESS"
+}
+
+// LastBuiltRevision returns the SHA1 of the git revision the build checked out,
+// or an empty string if the build did not check out a git repository.
+func (build Build) LastBuiltRevision() string {
+	for _, action := range build.Actions {
+		if action.LastBuiltRevision != nil {
+			return action.LastBuiltRevision.SHA1
+		}
+	}
+	return ""
+}
+
+// StartTime returns when the build started.
+func (build Build) StartTime() time.Time {
+	return time.Unix(0, build.Timestamp*int64(time.Millisecond))
 }
 
 type Job struct {
+	Class string `json:"_class"`
 	Name  string `json:"name"`
 	Url   string `json:"url"`
 	Color string `json:"color"`
@@ -37,6 +94,10 @@ type Job struct {
 	Description  string   `json:"description"`
 	HealthReport []Health `json:"healthReport"`
 
+	Builds          []Build `json:"builds"`
+	NextBuildNumber int     `json:"nextBuildNumber"`
+
+	LastBuild             Build `json:"lastBuild"`
 	LastCompletedBuild    Build `json:"lastCompletedBuild"`
 	LastFailedBuild       Build `json:"lastFailedBuild"`
 	LastStableBuild       Build `json:"lastStableBuild"`
@@ -45,8 +106,90 @@ type Job struct {
 	LastUnsuccessfulBuild Build `json:"lastUnsuccessfulBuild"`
 }
 
-type Health struct {
+// JobStatus is the status of a job's last build, as shown by the color of its ball.
+type JobStatus int
+
+const (
+	JobStatusUnknown JobStatus = iota
+	JobStatusSuccess
+	JobStatusFailed
+	JobStatusUnstable
+	JobStatusAborted
+	JobStatusDisabled
+	JobStatusNotBuilt
+)
+
+var jobStatusColors = map[string]JobStatus{
+	"blue":     JobStatusSuccess,
+	"red":      JobStatusFailed,
+	"yellow":   JobStatusUnstable,
+	"aborted":  JobStatusAborted,
+	"disabled": JobStatusDisabled,
+	"grey":     JobStatusDisabled,
+	"notbuilt": JobStatusNotBuilt,
+}
+
+// Status returns the status of the job's last completed build, derived from its color.
+// Jobs without a color, such as folders, are JobStatusUnknown.
+func (job Job) Status() JobStatus {
+	return jobStatusColors[strings.TrimSuffix(job.Color, "_anime")]
+}
+
+// IsBuilding reports whether the job is building, which Jenkins shows as an animated ball.
+func (job Job) IsBuilding() bool {
+	return strings.HasSuffix(job.Color, "_anime")
+}
+
+const FolderClass = "com.cloudbees.hudson.plugins.folder.Folder"
+
+// Folder is a folder of the CloudBees Folders plugin.
+type Folder struct {
+	Class       string `json:"_class"`
+	Name        string `json:"name"`
+	FullName    string `json:"fullName"`
+	Url         string `json:"url"`
 	Description string `json:"description"`
+	Jobs        []Job  `json:"jobs"`
+}
+
+// folderClasses are the job classes which hold other jobs rather than build themselves.
+var folderClasses = map[string]bool{
+	FolderClass:                         true,
+	"jenkins.branch.OrganizationFolder": true,
+	"org.jenkinsci.plugins.workflow.multibranch.WorkflowMultiBranchProject": true,
+}
+
+// IsFolder reports whether the job is a folder holding other jobs.
+func (job Job) IsFolder() bool {
+	return folderClasses[job.Class]
+}
+
+// ParameterDefinition describes a parameter a job accepts.
+// Type is e.g. StringParameterDefinition, BooleanParameterDefinition or ChoiceParameterDefinition,
+// and Choices is only set for the latter.
+type ParameterDefinition struct {
+	Class                 string          `json:"_class"`
+	Name                  string          `json:"name"`
+	Type                  string          `json:"type"`
+	Description           string          `json:"description"`
+	DefaultParameterValue *ParameterValue `json:"defaultParameterValue"`
+	Choices               []string        `json:"choices"`
+}
+
+// BuildParameter is a parameter value sent with BuildWithJSONParameters.
+// Value is typically a string, a bool or, for multi-select parameters, a []string.
+type BuildParameter struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Health is one aspect of a job's health, such as its build stability.
+// Score is a percentage, 100 being the healthiest.
+type Health struct {
+	Description   string `json:"description"`
+	Score         int    `json:"score"`
+	IconClassName string `json:"iconClassName"`
+	IconUrl       string `json:"iconUrl"`
 }
 
 type MavenJobItem struct {
@@ -200,6 +343,19 @@ type LocalBranch struct {
 	LocalBranch string `xml:"localBranch"`
 }
 
+// MarshalXML implements xml.Marshaler interface
+// Encode the Scm content directly inside the scm element, as Jenkins expects it.
+func (iscm Scm) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "class"}, Value: iscm.Class})
+	if iscm.Plugin != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "plugin"}, Value: iscm.Plugin})
+	}
+	if iscm.ScmContent == nil {
+		return e.EncodeElement(struct{}{}, start)
+	}
+	return e.EncodeElement(iscm.ScmContent, start)
+}
+
 //UnmarshalXML implements xml.UnmarshalXML intrface
 //Decode between multiple types of Scm. for now only SVN is supported
 func (iscm *Scm) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
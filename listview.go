@@ -2,12 +2,29 @@ package gojenkins
 
 import "encoding/xml"
 
+type View struct {
+	Class       string `json:"_class"`
+	Name        string `json:"name"`
+	Url         string `json:"url"`
+	Description string `json:"description"`
+	Jobs        []Job  `json:"jobs"`
+}
+
 type ListView struct {
 	XMLName         xml.Name `xml:"hudson.model.ListView"`
 	Name            string   `xml:"name"`
+	Description     string   `xml:"description,omitempty"`
 	FilterExecutors bool     `xml:"filterExecutors"`
 	FilterQueue     bool     `xml:"filterQueue"`
-	Columns         Columns  `xml:"columns"`
+	// JobNames are the jobs explicitly added to the view.
+	JobNames []string `xml:"jobNames>string"`
+	// JobFilters add jobs to or remove jobs from the view, e.g. by their status.
+	JobFilters JobFilters `xml:"jobFilters"`
+	Columns    Columns    `xml:"columns"`
+	// IncludeRegex, when set, adds the jobs whose name matches it to the view.
+	IncludeRegex string `xml:"includeRegex,omitempty"`
+	// Recurse makes the view include jobs in folders.
+	Recurse bool `xml:"recurse"`
 }
 
 func NewListView(name string) ListView {
@@ -23,6 +40,92 @@ type Columns struct {
 	Column  []Column
 }
 
+// columnTypes are the column types UnmarshalXML knows by element name.
+var columnTypes = map[string]func() Column{
+	"hudson.views.StatusColumn":       func() Column { return &StatusColumn{} },
+	"hudson.views.WeatherColumn":      func() Column { return &WeatherColumn{} },
+	"hudson.views.JobColumn":          func() Column { return &JobColumn{} },
+	"hudson.views.LastSuccessColumn":  func() Column { return &LastSuccessColumn{} },
+	"hudson.views.LastFailureColumn":  func() Column { return &LastFailureColumn{} },
+	"hudson.views.LastDurationColumn": func() Column { return &LastDurationColumn{} },
+	"hudson.views.BuildButtonColumn":  func() Column { return &BuildButtonColumn{} },
+}
+
+// UnmarshalXML implements xml.Unmarshaler. Columns of other types, e.g. from plugins, are kept
+// as a RawColumn so that they survive being marshalled again.
+func (columns *Columns) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	columns.XMLName = start.Name
+	columns.Column = nil
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			var column Column = &RawColumn{}
+			if newColumn, ok := columnTypes[token.Name.Local]; ok {
+				column = newColumn()
+			}
+			if err := d.DecodeElement(column, &token); err != nil {
+				return err
+			}
+			columns.Column = append(columns.Column, column)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// RawColumn is a column of a type this package has no struct for.
+type RawColumn struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	InnerXml string     `xml:",innerxml"`
+}
+
+// JobFilter is a job filter of a view, e.g. a RawJobFilter.
+type JobFilter interface {
+}
+
+type JobFilters struct {
+	XMLName xml.Name `xml:"jobFilters"`
+	Filter  []JobFilter
+}
+
+// UnmarshalXML implements xml.Unmarshaler. Job filters, which all come from plugins, are kept as
+// a RawJobFilter so that they survive being marshalled again.
+func (filters *JobFilters) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	filters.XMLName = start.Name
+	filters.Filter = nil
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			filter := &RawJobFilter{}
+			if err := d.DecodeElement(filter, &token); err != nil {
+				return err
+			}
+			filters.Filter = append(filters.Filter, filter)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// RawJobFilter is a job filter as it appears in the config.xml of a view, such as a
+// hudson.views.RegExJobFilter of the View Job Filters plugin.
+type RawJobFilter struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	InnerXml string     `xml:",innerxml"`
+}
+
 type StatusColumn struct {
 	XMLName xml.Name `xml:"hudson.views.StatusColumn"`
 }
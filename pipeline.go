@@ -0,0 +1,54 @@
+package gojenkins
+
+import "encoding/xml"
+
+const (
+	CpsFlowDefinitionClass    = "org.jenkinsci.plugins.workflow.cps.CpsFlowDefinition"
+	CpsScmFlowDefinitionClass = "org.jenkinsci.plugins.workflow.cps.CpsScmFlowDefinition"
+)
+
+// PipelineJobItem is the config.xml of a pipeline (WorkflowJob) job.
+type PipelineJobItem struct {
+	XMLName          xml.Name           `xml:"flow-definition"`
+	Plugin           string             `xml:"plugin,attr,omitempty"`
+	Actions          string             `xml:"actions"`
+	Description      string             `xml:"description"`
+	KeepDependencies string             `xml:"keepDependencies"`
+	Properties       JobProperties      `xml:"properties"`
+	Definition       PipelineDefinition `xml:"definition"`
+	Triggers         Triggers           `xml:"triggers"`
+	Disabled         string             `xml:"disabled"`
+}
+
+// PipelineDefinition tells a pipeline job where its script comes from: inline in the job
+// (CpsFlowDefinition) or from a Jenkinsfile checked out of an Scm (CpsScmFlowDefinition).
+type PipelineDefinition struct {
+	Class       string `xml:"class,attr"`
+	Plugin      string `xml:"plugin,attr,omitempty"`
+	Script      string `xml:"script,omitempty"`
+	Sandbox     bool   `xml:"sandbox,omitempty"`
+	Scm         *Scm   `xml:"scm,omitempty"`
+	ScriptPath  string `xml:"scriptPath,omitempty"`
+	Lightweight bool   `xml:"lightweight,omitempty"`
+}
+
+// NewInlinePipelineDefinition returns a definition running script, in the Groovy sandbox if sandbox is set.
+func NewInlinePipelineDefinition(script string, sandbox bool) PipelineDefinition {
+	return PipelineDefinition{Class: CpsFlowDefinitionClass, Script: script, Sandbox: sandbox}
+}
+
+// NewScmPipelineDefinition returns a definition running the Jenkinsfile at scriptPath in scm.
+func NewScmPipelineDefinition(scm Scm, scriptPath string) PipelineDefinition {
+	return PipelineDefinition{Class: CpsScmFlowDefinitionClass, Scm: &scm, ScriptPath: scriptPath}
+}
+
+// Stage is a stage of a pipeline build, as described by the Pipeline Stage View plugin.
+// Status is e.g. SUCCESS, FAILED, IN_PROGRESS or NOT_EXECUTED.
+type Stage struct {
+	Id                  string `json:"id"`
+	Name                string `json:"name"`
+	Status              string `json:"status"`
+	StartTimeMillis     int64  `json:"startTimeMillis"`
+	DurationMillis      int64  `json:"durationMillis"`
+	PauseDurationMillis int64  `json:"pauseDurationMillis"`
+}
@@ -0,0 +1,32 @@
+package gojenkins
+
+import "encoding/xml"
+
+type pluginInstallRequest struct {
+	XMLName xml.Name        `xml:"jenkins"`
+	Install []pluginInstall `xml:"install"`
+}
+
+type pluginInstall struct {
+	Plugin string `xml:"plugin,attr"`
+}
+
+type UpdateCenterStatus struct {
+	RestartRequiredForCompletion bool              `json:"restartRequiredForCompletion"`
+	Jobs                         []UpdateCenterJob `json:"jobs"`
+}
+
+// UpdateCenterJob is a task of the update center, such as a plugin installation.
+type UpdateCenterJob struct {
+	Id           int                   `json:"id"`
+	Type         string                `json:"type"`
+	Name         string                `json:"name"`
+	ErrorMessage string                `json:"errorMessage"`
+	Status       UpdateCenterJobStatus `json:"status"`
+}
+
+// UpdateCenterJobStatus is e.g. Pending, Installing, Success or Failure.
+type UpdateCenterJobStatus struct {
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+}
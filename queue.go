@@ -1,5 +1,7 @@
 package gojenkins
 
+import "time"
+
 type Queue struct {
 	Items []Item `json:"items"`
 }
@@ -17,17 +19,55 @@ type Item struct {
 	Why                        string     `json:"why"`
 	BuildableStartMilliseconds int64      `json:"buildableStartMilliseconds"`
 	Pending                    bool       `json:"pending"`
+	Cancelled                  bool       `json:"cancelled"`
 	Executable                 Executable `json:"executable"`
 }
 
+// WaitDuration returns how long the item has been waiting in the queue.
+func (item Item) WaitDuration() time.Duration {
+	return time.Since(time.Unix(0, item.InQueueSince*int64(time.Millisecond)))
+}
+
 type Action struct {
-	Causes []Cause
+	Class      string           `json:"_class"`
+	Causes     []Cause          `json:"causes"`
+	Parameters []ParameterValue `json:"parameters"`
+
+	// LastBuiltRevision is only set for the git plugin's hudson.plugins.git.util.BuildData action.
+	LastBuiltRevision *Revision `json:"lastBuiltRevision"`
+}
+
+// Revision is a git revision and the branches pointing at it.
+type Revision struct {
+	SHA1   string   `json:"SHA1"`
+	Branch []Branch `json:"branch"`
 }
 
+type Branch struct {
+	Name string `json:"name"`
+	SHA1 string `json:"SHA1"`
+}
+
+// ParameterValue is the value a parameter of a build was given.
+// Value is a string or a bool depending on the parameter type, and nil for password parameters,
+// whose value Jenkins does not expose.
+type ParameterValue struct {
+	Class string      `json:"_class"`
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Cause is why a build was started. Which fields are set depends on Class, e.g. UserId and UserName
+// for hudson.model.Cause$UserIdCause and the Upstream fields for hudson.model.Cause$UpstreamCause.
 type Cause struct {
+	Class            string `json:"_class"`
 	ShortDescription string `json:"shortDescription"`
 	UserId           string `json:"userId"`
 	UserName         string `json:"userName"`
+
+	UpstreamProject string `json:"upstreamProject"`
+	UpstreamBuild   int    `json:"upstreamBuild"`
+	UpstreamUrl     string `json:"upstreamUrl"`
 }
 
 type Task struct {
@@ -37,6 +77,6 @@ type Task struct {
 }
 
 type Executable struct {
-	number int    `json:"number"`
+	Number int    `json:"number"`
 	Url    string `json:"url"`
 }
@@ -0,0 +1,26 @@
+package gojenkins
+
+type TestResult struct {
+	Duration  float64     `json:"duration"`
+	Empty     bool        `json:"empty"`
+	FailCount int         `json:"failCount"`
+	PassCount int         `json:"passCount"`
+	SkipCount int         `json:"skipCount"`
+	Suites    []TestSuite `json:"suites"`
+}
+
+type TestSuite struct {
+	Name     string     `json:"name"`
+	Duration float64    `json:"duration"`
+	Cases    []TestCase `json:"cases"`
+}
+
+type TestCase struct {
+	ClassName       string  `json:"className"`
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	Duration        float64 `json:"duration"`
+	Skipped         bool    `json:"skipped"`
+	ErrorDetails    string  `json:"errorDetails"`
+	ErrorStackTrace string  `json:"errorStackTrace"`
+}
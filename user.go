@@ -0,0 +1,11 @@
+package gojenkins
+
+// User is the identity requests are authenticated as.
+// Anonymous users have the id "anonymous" and no full name.
+type User struct {
+	Id            string   `json:"id"`
+	FullName      string   `json:"fullName"`
+	Authenticated bool     `json:"authenticated"`
+	Anonymous     bool     `json:"anonymous"`
+	Authorities   []string `json:"authorities"`
+}